@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"zrpc"
+	"zrpc/metadata"
+	"zrpc/peer"
+)
+
+// MetadataKey per call credentials are sent in this metadata key, they take
+// precedence over the credential sent in codec.Option during the handshake
+const MetadataKey = "authorization"
+
+const (
+	BearerPrefix = "Bearer "
+	HMACPrefix   = "HMAC "
+)
+
+var errMissingCredential = errors.New("missing credential")
+
+// Authenticator validates a credential and returns the caller identity,
+// errors are reported to the caller as zrpc.ErrUnauthenticated
+type Authenticator interface {
+	Authenticate(ctx context.Context, credential string) (identity string, err error)
+}
+
+type AuthenticatorFunc func(ctx context.Context, credential string) (string, error)
+
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, credential string) (string, error) {
+	return f(ctx, credential)
+}
+
+// Tokens bearer tokens: "Bearer <token>" -> identity
+type Tokens map[string]string
+
+func (t Tokens) Authenticate(_ context.Context, credential string) (string, error) {
+	if credential == "" {
+		return "", errMissingCredential
+	}
+	if !strings.HasPrefix(credential, BearerPrefix) {
+		return "", errors.New("not a bearer token")
+	}
+	identity, ok := t[strings.TrimPrefix(credential, BearerPrefix)]
+	if !ok {
+		return "", errors.New("unknown token")
+	}
+	return identity, nil
+}
+
+func BearerToken(token string) string {
+	return BearerPrefix + token
+}
+
+// TLSSubject authenticates callers by the common name of their verified client
+// certificate, see server.ServeTLS; the credential is ignored
+type TLSSubject struct{}
+
+func (TLSSubject) Authenticate(ctx context.Context, _ string) (string, error) {
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(peer.TLSInfo); ok {
+			if subject, ok := info.Subject(); ok && subject.CommonName != "" {
+				return subject.CommonName, nil
+			}
+		}
+	}
+	return "", errors.New("no verified client certificate")
+}
+
+// HMAC shared keys per identity: "HMAC <identity>:<unix seconds>:<nonce>:<hex signature>".
+// The signature also covers the called Service.Method (empty for the credential sent
+// during the handshake), so a captured credential can't be used for another method;
+// signatures older or newer than MaxSkew, or seen before, are rejected
+type HMAC struct {
+	Keys    map[string][]byte
+	MaxSkew time.Duration // 0 means 5 minutes
+
+	mu      sync.Mutex
+	seen    map[string]struct{} // signatures used since rotated
+	prev    map[string]struct{} // signatures used in the period before
+	rotated time.Time
+}
+
+// SignHMAC builds the credential HMAC expects for a call of serviceMethod,
+// signed with key at t; use an empty serviceMethod for codec.Option.Credential
+func SignHMAC(identity string, key []byte, serviceMethod string, t time.Time) string {
+	var nonce [8]byte
+	_, _ = rand.Read(nonce[:])
+	payload := identity + ":" + strconv.FormatInt(t.Unix(), 10) + ":" + hex.EncodeToString(nonce[:])
+	return HMACPrefix + payload + ":" + sign(key, payload, serviceMethod)
+}
+
+func sign(key []byte, payload, serviceMethod string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload + "\n" + serviceMethod))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (h *HMAC) Authenticate(ctx context.Context, credential string) (string, error) {
+	if credential == "" {
+		return "", errMissingCredential
+	}
+	if !strings.HasPrefix(credential, HMACPrefix) {
+		return "", errors.New("not a hmac credential")
+	}
+	// identity:ts:nonce:signature, the identity may contain ':'
+	parts := strings.Split(strings.TrimPrefix(credential, HMACPrefix), ":")
+	if len(parts) < 4 {
+		return "", errors.New("malformed hmac credential")
+	}
+	n := len(parts)
+	identity, signature := strings.Join(parts[:n-3], ":"), parts[n-1]
+	payload := strings.Join(parts[:n-1], ":")
+	ts, err := strconv.ParseInt(parts[n-3], 10, 64)
+	if err != nil {
+		return "", errors.New("malformed hmac timestamp")
+	}
+	key, ok := h.Keys[identity]
+	if !ok || !hmac.Equal([]byte(signature), []byte(sign(key, payload, ServiceMethodFromContext(ctx)))) {
+		return "", errors.New("invalid hmac signature")
+	}
+	skew := h.MaxSkew
+	if skew <= 0 {
+		skew = 5 * time.Minute
+	}
+	signed := time.Unix(ts, 0)
+	if d := time.Since(signed); d > skew || d < -skew {
+		return "", errors.New("hmac credential expired")
+	}
+	if !h.firstUse(signature, skew) {
+		return "", errors.New("hmac credential replayed")
+	}
+	return identity, nil
+}
+
+// firstUse remembers signature for at least 2*skew, by then the credential has
+// expired. Instead of sweeping expired signatures on every call the two sets
+// are rotated every 2*skew, so each call does constant work.
+func (h *HMAC) firstUse(signature string, skew time.Duration) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if since := time.Since(h.rotated); h.seen == nil || since >= 2*skew {
+		h.prev, h.seen, h.rotated = h.seen, make(map[string]struct{}), time.Now()
+		if since >= 4*skew {
+			h.prev = nil
+		}
+	}
+	if _, ok := h.seen[signature]; ok {
+		return false
+	}
+	if _, ok := h.prev[signature]; ok {
+		return false
+	}
+	h.seen[signature] = struct{}{}
+	return true
+}
+
+type serviceMethodKey struct{}
+
+// WithServiceMethod used by the server to tell Authenticators which method is
+// being called, the handshake credential is checked without one
+func WithServiceMethod(ctx context.Context, serviceMethod string) context.Context {
+	return context.WithValue(ctx, serviceMethodKey{}, serviceMethod)
+}
+
+func ServiceMethodFromContext(ctx context.Context) string {
+	serviceMethod, _ := ctx.Value(serviceMethodKey{}).(string)
+	return serviceMethod
+}
+
+// Policy maps identities to the Service.Method patterns (path.Match syntax,
+// e.g. "Foo.Sum", "Foo.*", "*") they may call; the identity "*" applies to everyone
+type Policy struct {
+	mu    sync.RWMutex
+	rules map[string][]string
+}
+
+func NewPolicy() *Policy {
+	return &Policy{rules: make(map[string][]string)}
+}
+
+// Allow grants identity the methods matching patterns
+func (p *Policy) Allow(identity string, patterns ...string) *Policy {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rules[identity] = append(p.rules[identity], patterns...)
+	return p
+}
+
+// Authorize a nil Policy lets every authenticated identity call everything,
+// otherwise the error wraps zrpc.ErrPermissionDenied
+func (p *Policy) Authorize(identity, serviceMethod string) error {
+	if p == nil {
+		return nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if match(p.rules[identity], serviceMethod) || match(p.rules["*"], serviceMethod) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s may not call %s", zrpc.ErrPermissionDenied, identity, serviceMethod)
+}
+
+func match(patterns []string, serviceMethod string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, serviceMethod); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticate runs a on credential, which may be empty when the caller sent
+// none, a decides whether that is acceptable; the error wraps zrpc.ErrUnauthenticated
+func Authenticate(ctx context.Context, a Authenticator, credential string) (string, error) {
+	identity, err := a.Authenticate(ctx, credential)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", zrpc.ErrUnauthenticated, err)
+	}
+	return identity, nil
+}
+
+type identityKey struct{}
+
+// NewContext used by the server to hand the authenticated identity to
+// interceptors and service methods
+func NewContext(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+func FromContext(ctx context.Context) (string, bool) {
+	identity, ok := ctx.Value(identityKey{}).(string)
+	return identity, ok
+}
+
+// WithCredential sends credential with every call made with ctx
+func WithCredential(ctx context.Context, credential string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, MetadataKey, credential)
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"zrpc"
+)
+
+func TestHMAC(t *testing.T) {
+	h := &HMAC{Keys: map[string][]byte{"svc:a": []byte("k1")}, MaxSkew: time.Minute}
+	ctx := WithServiceMethod(context.Background(), "Foo.Sum")
+	credential := SignHMAC("svc:a", []byte("k1"), "Foo.Sum", time.Now())
+	identity, err := h.Authenticate(ctx, credential)
+	if err != nil || identity != "svc:a" {
+		t.Fatalf("expect svc:a, got %q: %v", identity, err)
+	}
+	if _, err = h.Authenticate(ctx, credential); err == nil {
+		t.Fatal("expect a replayed credential to be rejected")
+	}
+	for _, credential := range []string{
+		SignHMAC("svc:a", []byte("k2"), "Foo.Sum", time.Now()),
+		SignHMAC("svc:a", []byte("k1"), "Foo.Sum", time.Now().Add(-2*time.Minute)),
+		SignHMAC("svc:a", []byte("k1"), "Foo.Delete", time.Now()),
+		SignHMAC("svc:a", []byte("k1"), "", time.Now()),
+		SignHMAC("svc:b", []byte("k1"), "Foo.Sum", time.Now()),
+		BearerToken("k1"),
+		"HMAC svc:a",
+	} {
+		if _, err = h.Authenticate(ctx, credential); err == nil {
+			t.Fatalf("expect %q to be rejected", credential)
+		}
+	}
+
+	// the handshake credential is signed without a method
+	if _, err = h.Authenticate(context.Background(), SignHMAC("svc:a", []byte("k1"), "", time.Now())); err != nil {
+		t.Fatalf("handshake credential rejected: %v", err)
+	}
+}
+
+func TestHMAC_Rotate(t *testing.T) {
+	h := &HMAC{}
+	skew := time.Minute
+	if !h.firstUse("a", skew) || h.firstUse("a", skew) {
+		t.Fatal("expect only the first use to pass")
+	}
+	// a signature is still remembered in the period after it was used
+	h.rotated = h.rotated.Add(-2 * skew)
+	if h.firstUse("a", skew) || !h.firstUse("b", skew) {
+		t.Fatal("expect signatures of the previous period to be remembered")
+	}
+	// and forgotten once it can only have expired
+	h.rotated = h.rotated.Add(-2 * skew)
+	if !h.firstUse("a", skew) || h.firstUse("b", skew) {
+		t.Fatal("expect only the previous period to be remembered")
+	}
+	h.rotated = h.rotated.Add(-4 * skew)
+	if !h.firstUse("b", skew) || len(h.prev) != 0 {
+		t.Fatal("expect everything forgotten after an idle period")
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	p := NewPolicy().Allow("admin", "*").Allow("reader", "Foo.Get*", "Bar.List").Allow("*", "Health.Check")
+	cases := []struct {
+		identity, method string
+		allowed          bool
+	}{
+		{"admin", "Foo.Delete", true},
+		{"reader", "Foo.GetUser", true},
+		{"reader", "Bar.List", true},
+		{"reader", "Foo.Delete", false},
+		{"nobody", "Health.Check", true},
+		{"nobody", "Foo.GetUser", false},
+	}
+	for _, c := range cases {
+		err := p.Authorize(c.identity, c.method)
+		if (err == nil) != c.allowed || (err != nil && !errors.Is(err, zrpc.ErrPermissionDenied)) {
+			t.Fatalf("%s calling %s: unexpected %v", c.identity, c.method, err)
+		}
+	}
+	if err := (*Policy)(nil).Authorize("anyone", "Foo.Delete"); err != nil {
+		t.Fatalf("nil policy must allow everything: %v", err)
+	}
+	if _, err := Authenticate(context.Background(), Tokens{"t": "x"}, ""); !errors.Is(err, zrpc.ErrUnauthenticated) {
+		t.Fatalf("expect ErrUnauthenticated, got %v", err)
+	}
+}
@@ -0,0 +1,233 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+	"zrpc"
+)
+
+type BreakerState int
+
+const (
+	StateClosed   BreakerState = iota // 正常放行
+	StateOpen                         // 直接返回zrpc.ErrCircuitOpen
+	StateHalfOpen                     // 冷却结束，放行少量试探请求
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	default:
+		return "half-open"
+	}
+}
+
+// BreakerConfig 两个阈值任意一个达到即打开熔断
+type BreakerConfig struct {
+	ConsecutiveFailures int           // 连续失败次数，0表示不按此判断
+	FailureRate         float64       // 窗口内的失败率，0表示不按此判断
+	MinRequests         int           // 窗口内请求数达到后才计算失败率
+	Window              time.Duration // 统计失败率的窗口，0表示不重置
+	Cooldown            time.Duration // 打开后经过多久进入半开
+	HalfOpenRequests    int           // 半开时的试探请求数，全部成功后关闭，<=0按1处理
+
+	PerMethod bool // 同一地址的每个方法分别熔断
+	// IsFailure 判断调用是否失败，nil时用IsBreakerFailure
+	IsFailure func(err error) bool
+}
+
+var DefaultBreakerConfig = BreakerConfig{
+	ConsecutiveFailures: 5,
+	FailureRate:         0.5,
+	MinRequests:         20,
+	Window:              10 * time.Second,
+	Cooldown:            5 * time.Second,
+	HalfOpenRequests:    1,
+}
+
+// IsBreakerFailure 连接错误和超时说明服务端有问题，服务端返回的业务错误不算失败
+func IsBreakerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, zrpc.RpcClientCallServiceTimeOut) || errors.Is(err, zrpc.ServerHandleRequestTimeOut) {
+		return true
+	}
+	return IsRetryable(err)
+}
+
+// Breaker 一个地址（或地址上的一个方法）的熔断器
+type Breaker struct {
+	cfg BreakerConfig
+
+	mu          sync.Mutex
+	state       BreakerState
+	generation  uint64 // 每次状态变化加1，旧状态下放行的请求结果被忽略
+	consecutive int
+	requests    int
+	failures    int
+	windowStart time.Time
+	openedAt    time.Time
+	probes      int // 半开时已放行的试探请求
+	successes   int // 半开时成功的试探请求
+}
+
+func NewBreaker(cfg BreakerConfig) *Breaker {
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 1
+	}
+	return &Breaker{cfg: cfg, windowStart: time.Now()}
+}
+
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refresh(time.Now())
+	return b.state
+}
+
+// Allow 熔断打开时返回zrpc.ErrCircuitOpen，否则返回的generation交给Record
+func (b *Breaker) Allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refresh(time.Now())
+	switch b.state {
+	case StateOpen:
+		return 0, zrpc.ErrCircuitOpen
+	case StateHalfOpen:
+		if b.probes >= b.cfg.HalfOpenRequests {
+			return 0, zrpc.ErrCircuitOpen
+		}
+		b.probes++
+	}
+	return b.generation, nil
+}
+
+// Record 记录Allow放行的请求的结果
+func (b *Breaker) Record(generation uint64, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.refresh(now)
+	if generation != b.generation {
+		return
+	}
+	if b.state == StateHalfOpen {
+		if failed {
+			b.setState(StateOpen, now)
+		} else if b.successes++; b.successes >= b.cfg.HalfOpenRequests {
+			b.setState(StateClosed, now)
+		}
+		return
+	}
+
+	b.requests++
+	if failed {
+		b.failures++
+		b.consecutive++
+	} else {
+		b.consecutive = 0
+	}
+	if b.cfg.ConsecutiveFailures > 0 && b.consecutive >= b.cfg.ConsecutiveFailures {
+		b.setState(StateOpen, now)
+		return
+	}
+	if b.cfg.FailureRate > 0 && b.requests >= b.cfg.MinRequests &&
+		float64(b.failures)/float64(b.requests) >= b.cfg.FailureRate {
+		b.setState(StateOpen, now)
+	}
+}
+
+// Cancel Allow放行的请求被调用方取消，不计入统计，半开时归还试探名额
+func (b *Breaker) Cancel(generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation == b.generation && b.state == StateHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// refresh 冷却结束进入半开，统计窗口到期后重新计数
+func (b *Breaker) refresh(now time.Time) {
+	switch b.state {
+	case StateOpen:
+		if now.Sub(b.openedAt) >= b.cfg.Cooldown {
+			b.setState(StateHalfOpen, now)
+		}
+	case StateClosed:
+		if b.cfg.Window > 0 && now.Sub(b.windowStart) >= b.cfg.Window {
+			b.requests, b.failures, b.windowStart = 0, 0, now
+		}
+	}
+}
+
+func (b *Breaker) setState(state BreakerState, now time.Time) {
+	b.state = state
+	b.generation++
+	b.consecutive, b.requests, b.failures, b.windowStart = 0, 0, 0, now
+	b.probes, b.successes = 0, 0
+	if state == StateOpen {
+		b.openedAt = now
+	}
+}
+
+// BreakerGroup 按服务端地址（PerMethod时按地址和方法）分别维护熔断器
+type BreakerGroup struct {
+	cfg BreakerConfig
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+func NewBreakerGroup(cfg BreakerConfig) *BreakerGroup {
+	return &BreakerGroup{
+		cfg:      cfg,
+		breakers: make(map[string]*Breaker),
+	}
+}
+
+func (g *BreakerGroup) Get(addr, serviceMethod string) *Breaker {
+	key := addr
+	if g.cfg.PerMethod {
+		key += "/" + serviceMethod
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	b, ok := g.breakers[key]
+	if !ok {
+		b = NewBreaker(g.cfg)
+		g.breakers[key] = b
+	}
+	return b
+}
+
+func (g *BreakerGroup) isFailure(err error) bool {
+	if g.cfg.IsFailure != nil {
+		return g.cfg.IsFailure(err)
+	}
+	return IsBreakerFailure(err)
+}
+
+// BreakerInterceptor 熔断打开时调用直接返回zrpc.ErrCircuitOpen，不再等待超时；
+// 调用方主动取消的调用不计入统计
+func BreakerInterceptor(g *BreakerGroup) Interceptor {
+	return func(ctx context.Context, c *Client, serviceMethod string, args, reply interface{}, next Invoker) error {
+		b := g.Get(c.Addr(), serviceMethod)
+		generation, err := b.Allow()
+		if err != nil {
+			return err
+		}
+		err = next(ctx, serviceMethod, args, reply)
+		if errors.Is(ctx.Err(), context.Canceled) {
+			b.Cancel(generation)
+			return err
+		}
+		b.Record(generation, g.isFailure(err))
+		return err
+	}
+}
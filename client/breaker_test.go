@@ -0,0 +1,58 @@
+package client
+
+import (
+	"testing"
+	"time"
+	"zrpc"
+)
+
+func TestBreaker_ConsecutiveFailures(t *testing.T) {
+	b := NewBreaker(BreakerConfig{ConsecutiveFailures: 2, Cooldown: 50 * time.Millisecond})
+	for i := 0; i < 2; i++ {
+		gen, err := b.Allow()
+		_assert(err == nil, "closed breaker rejected a call")
+		b.Record(gen, true)
+	}
+	_, err := b.Allow()
+	_assert(err == zrpc.ErrCircuitOpen && b.State() == StateOpen, "expect open, got %v %v", b.State(), err)
+
+	// after the cooldown a single probe is let through, its failure opens again
+	time.Sleep(60 * time.Millisecond)
+	gen, err := b.Allow()
+	_assert(err == nil && b.State() == StateHalfOpen, "expect half-open probe, got %v %v", b.State(), err)
+	_, err = b.Allow()
+	_assert(err == zrpc.ErrCircuitOpen, "half-open breaker let a second probe through")
+	b.Record(gen, true)
+	_assert(b.State() == StateOpen, "failed probe did not reopen, got %v", b.State())
+
+	// a successful probe closes it
+	time.Sleep(60 * time.Millisecond)
+	gen, _ = b.Allow()
+	b.Record(gen, false)
+	_assert(b.State() == StateClosed, "successful probe did not close, got %v", b.State())
+}
+
+func TestBreaker_FailureRate(t *testing.T) {
+	b := NewBreaker(BreakerConfig{FailureRate: 0.5, MinRequests: 4, Cooldown: time.Minute})
+	stale, _ := b.Allow()
+	for _, failed := range []bool{true, false, true} {
+		gen, _ := b.Allow()
+		b.Record(gen, failed)
+	}
+	_assert(b.State() == StateClosed, "opened below MinRequests")
+	gen, _ := b.Allow()
+	b.Record(gen, false)
+	_assert(b.State() == StateOpen, "expect open at 50%% failures, got %v", b.State())
+
+	// results of calls let through before the breaker opened are ignored
+	b.Record(stale, false)
+	_assert(b.State() == StateOpen, "stale result changed the state")
+}
+
+func TestBreakerGroup_PerMethod(t *testing.T) {
+	g := NewBreakerGroup(BreakerConfig{PerMethod: true})
+	_assert(g.Get("a", "Foo.Get") != g.Get("a", "Foo.Set"), "methods share a breaker")
+	_assert(g.Get("a", "Foo.Get") == g.Get("a", "Foo.Get"), "breaker not reused")
+	g = NewBreakerGroup(BreakerConfig{})
+	_assert(g.Get("a", "Foo.Get") == g.Get("a", "Foo.Set"), "address breaker split by method")
+}
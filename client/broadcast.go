@@ -0,0 +1,54 @@
+package client
+
+import (
+	"context"
+	"reflect"
+	"sync"
+)
+
+// Broadcast 使用DefaultClientCache并发调用所有地址，见ClientCache.Broadcast
+func Broadcast(ctx context.Context, addrs []string, serviceMethod string, args, reply interface{}) error {
+	return DefaultClientCache.Broadcast(ctx, addrs, serviceMethod, args, reply)
+}
+
+// Broadcast 并发调用所有地址，返回第一个错误并取消其余的调用；
+// 全部成功时reply为其中一个响应，reply为nil时不关心响应
+func (cc *ClientCache) Broadcast(ctx context.Context, addrs []string, serviceMethod string, args, reply interface{}) error {
+	if len(addrs) == 0 {
+		return ErrNoServers
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex // 保护e和replyDone
+	var e error
+	replyDone := reply == nil
+	for _, rpcAddr := range addrs {
+		wg.Add(1)
+		go func(rpcAddr string) {
+			defer wg.Done()
+			// 每个调用解码到各自的reply，避免并发写同一个值
+			var clonedReply interface{}
+			if reply != nil {
+				clonedReply = reflect.New(reflect.ValueOf(reply).Elem().Type()).Interface()
+			}
+			c, err := cc.Dial(rpcAddr)
+			if err == nil {
+				err = c.SyncCall(ctx, serviceMethod, args, clonedReply)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && e == nil {
+				e = err
+				cancel()
+			}
+			if err == nil && !replyDone {
+				reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(clonedReply).Elem())
+				replyDone = true
+			}
+		}(rpcAddr)
+	}
+	wg.Wait()
+	return e
+}
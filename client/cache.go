@@ -0,0 +1,114 @@
+package client
+
+import (
+	"sync"
+	"zrpc/codec"
+)
+
+// ClientCache 按地址缓存客户端，用到时才建立连接，不可用的被剔除后重新连接
+type ClientCache struct {
+	opt          *codec.Option
+	interceptors []Interceptor
+
+	mu      sync.Mutex
+	clients map[string]*Client
+}
+
+func NewClientCache(opt *codec.Option) *ClientCache {
+	return &ClientCache{
+		opt:     opt,
+		clients: make(map[string]*Client),
+	}
+}
+
+// DefaultClientCache Broadcast使用的缓存
+var DefaultClientCache = NewClientCache(nil)
+
+// WithInterceptors 之后建立的客户端都使用这些拦截器；需要在发起调用前设置
+func (cc *ClientCache) WithInterceptors(interceptors ...Interceptor) *ClientCache {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.interceptors = append(cc.interceptors, interceptors...)
+	return cc
+}
+
+// Dial rpcAddr格式为protocol@addr；建立连接时不持有锁，不会阻塞其他地址的Dial和Pending
+func (cc *ClientCache) Dial(rpcAddr string) (*Client, error) {
+	if c := cc.get(rpcAddr); c != nil {
+		return c, nil
+	}
+	c, err := XDial(rpcAddr, cc.opt)
+	if err != nil {
+		return nil, err
+	}
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	// 同时Dial同一个地址时只保留先放入缓存的
+	if cached, ok := cc.clients[rpcAddr]; ok {
+		if cached.IsAvailable() {
+			_ = c.Close()
+			return cached, nil
+		}
+		release(cached)
+	}
+	c.WithInterceptors(cc.interceptors...)
+	cc.clients[rpcAddr] = c
+	return c, nil
+}
+
+// get 返回缓存中可用的客户端，不可用的剔除
+func (cc *ClientCache) get(rpcAddr string) *Client {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	c, ok := cc.clients[rpcAddr]
+	if !ok {
+		return nil
+	}
+	if !c.IsAvailable() {
+		release(c)
+		delete(cc.clients, rpcAddr)
+		return nil
+	}
+	return c
+}
+
+// release 关闭剔除的客户端；收到go-away的连接上还有服务端会响应的调用，等服务端关闭连接后再关闭
+func release(c *Client) {
+	if c.Pending() == 0 {
+		_ = c.Close()
+		return
+	}
+	go func() {
+		<-c.Done()
+		_ = c.Close()
+	}()
+}
+
+// Pending 地址上进行中的调用数，没有连接时为0
+func (cc *ClientCache) Pending(rpcAddr string) int {
+	cc.mu.Lock()
+	c, ok := cc.clients[rpcAddr]
+	cc.mu.Unlock()
+	if !ok {
+		return 0
+	}
+	return c.Pending()
+}
+
+// Len 缓存的客户端数
+func (cc *ClientCache) Len() int {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return len(cc.clients)
+}
+
+func (cc *ClientCache) Close() error {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	for addr, c := range cc.clients {
+		// 已经关闭的客户端会返回ErrShutDown，忽略
+		_ = c.Close()
+		delete(cc.clients, addr)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+	"zrpc/codec"
+)
+
+func TestClientCache_Dial(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "listen failed: %v", err)
+	s := startServerOn(l)
+	defer func() { _ = s.Close() }()
+	addr := "tcp@" + l.Addr().String()
+
+	// a server that never answers the CONNECT holds its dial for ConnectTimeout
+	hung, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "listen failed: %v", err)
+	defer func() { _ = hung.Close() }()
+	go func() {
+		for {
+			conn, err := hung.Accept()
+			if err != nil {
+				return
+			}
+			defer func() { _ = conn.Close() }()
+		}
+	}()
+
+	cc := NewClientCache(&codec.Option{ConnectTimeout: time.Second})
+	defer func() { _ = cc.Close() }()
+	go func() { _, _ = cc.Dial("http@" + hung.Addr().String()) }()
+	time.Sleep(50 * time.Millisecond)
+
+	// other addresses are not held up by it, and concurrent dials share one client
+	start := time.Now()
+	clients := make([]*Client, 5)
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			clients[i], _ = cc.Dial(addr)
+		}(i)
+	}
+	wg.Wait()
+	_ = cc.Pending(addr)
+	_assert(time.Since(start) < 500*time.Millisecond, "dial waited for another address: %v", time.Since(start))
+	for _, c := range clients {
+		_assert(c != nil && c == clients[0] && c.IsAvailable(), "expect one shared client")
+	}
+}
+
+func TestClientCache_GoAway(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "listen failed: %v", err)
+	s := startServerOn(l)
+	addr := "tcp@" + l.Addr().String()
+	cc := NewClientCache(nil)
+	defer func() { _ = cc.Close() }()
+	c, err := cc.Dial(addr)
+	_assert(err == nil, "dial failed: %v", err)
+
+	var reply int
+	call := c.AsyncCall("Foo.Sleep", &Args{Num1: 200}, &reply, nil)
+	time.Sleep(50 * time.Millisecond)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_ = s.Shutdown(ctx)
+	}()
+	for i := 0; i < 50 && c.IsAvailable(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	_assert(!c.IsAvailable(), "client did not receive go away")
+
+	// the draining client is evicted, but its in-flight call is still answered
+	_, err = cc.Dial(addr)
+	_assert(err != nil && cc.Len() == 0, "expect the go away client evicted, got %v", err)
+	call = <-call.Done
+	_assert(call.Error == nil, "in-flight call failed: %v", call.Error)
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		_assert(false, "draining client was not closed")
+	}
+}
@@ -1,15 +1,23 @@
 package client
 
+import (
+	"time"
+	"zrpc/metadata"
+)
+
 type Call struct {
 	Seq           uint64
 	ServiceMethod string
 	Args          interface{}
 	Reply         interface{}
-	Error error
-	Done chan *Call
+	Metadata      metadata.MD // 随请求发送的metadata
+	Trailer       metadata.MD // 服务端随响应返回的trailer
+	Deadline      time.Time   // 调用方的deadline，剩余时间随请求发给服务端
+	Error         error
+	Done          chan *Call
 }
 
 // 调用结束时 调用此方法通知调用方
-func (c *Call) done()  {
+func (c *Call) done() {
 	c.Done <- c
 }
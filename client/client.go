@@ -1,20 +1,27 @@
 package client
 
 import (
+	"bufio"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
+	"strings"
 	"sync"
 	"time"
 	"zrpc"
 	"zrpc/codec"
 	"zrpc/logger"
+	"zrpc/metadata"
 )
 
 // Client 客户端：发送请求，接受请求
 type Client struct {
+	addr        string        // 服务端地址
 	cc          codec.Codec   // 约定的编解码方法
 	opt         *codec.Option // 消息头的opt
 	sendingLock sync.Mutex    // 保证客户端发送的消息不会混乱
@@ -25,23 +32,31 @@ type Client struct {
 	pendingCall map[uint64]*Call // 当前正在进行中的调用
 	closed      bool             // 客户端主动关闭
 	shutDown    bool             // 有错误发生关闭
+	goAway      bool             // 服务端正在关闭，不再发起新的调用
+	done        chan struct{}    // 连接断开后关闭
+
+	interceptors []Interceptor
+	invoker      Invoker // interceptors包裹后的SyncCall
 }
 
 func NewClient(conn net.Conn, opt *codec.Option) (*Client, error) {
-	codecFunc := codec.NewCodecFuncMap[opt.CodecType]
-	if codecFunc == nil {
-		return nil, fmt.Errorf("not found specific codec func")
+	cc, err := codec.NewCodec(conn, opt)
+	if err != nil {
+		return nil, err
 	}
 	if err := json.NewEncoder(conn).Encode(opt); err != nil {
 		logger.Error("encode option failed,err:%v", err)
 		return nil, err
 	}
 	client := &Client{
+		addr:        conn.RemoteAddr().String(),
 		currSeq:     1,
-		cc:          codecFunc(conn),
+		cc:          cc,
 		opt:         opt,
 		pendingCall: make(map[uint64]*Call),
+		done:        make(chan struct{}),
 	}
+	client.invoker = client.syncCall
 	go client.receive()
 	return client, nil
 }
@@ -53,13 +68,22 @@ type newClientRes struct {
 
 type newClient func(conn net.Conn, opt *codec.Option) (client *Client, err error)
 
+// connDialer 在timeout内建立连接
+type connDialer func(timeout time.Duration) (net.Conn, error)
+
 func dialWithTimeOut(newFunc newClient, network, address string, opts ...*codec.Option) (*Client, error) {
+	return dialConn(newFunc, func(timeout time.Duration) (net.Conn, error) {
+		return net.DialTimeout(network, address, timeout)
+	}, opts...)
+}
+
+func dialConn(newFunc newClient, dial connDialer, opts ...*codec.Option) (*Client, error) {
 	opt, err := codec.ParseOptions(opts...)
 	if err != nil {
 		logger.Error("parse options failed,err:%v", err)
 		return nil, err
 	}
-	conn, err := net.DialTimeout(network, address, opt.ConnectTimeout)
+	conn, err := dial(opt.ConnectTimeout)
 	if err != nil {
 		logger.Error("dial network failed,err:%v", err)
 		return nil, err
@@ -96,6 +120,63 @@ func Dial(network, address string, opts ...*codec.Option) (*Client, error) {
 	return dialWithTimeOut(NewClient, network, address, opts...)
 }
 
+// DialTLS 通过TLS连接，config带上客户端证书即为双向认证；ConnectTimeout包括TLS握手
+func DialTLS(network, address string, config *tls.Config, opts ...*codec.Option) (*Client, error) {
+	return dialConn(NewClient, func(timeout time.Duration) (net.Conn, error) {
+		return tls.DialWithDialer(&net.Dialer{Timeout: timeout}, network, address, config)
+	}, opts...)
+}
+
+// NewHTTPClient 先通过HTTP CONNECT切换协议，再按rpc协议通信
+func NewHTTPClient(conn net.Conn, opt *codec.Option) (*Client, error) {
+	_, err := io.WriteString(conn, fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", codec.DefaultRPCPath, conn.RemoteAddr()))
+	if err != nil {
+		logger.Error("write connect request failed,err:%v", err)
+		return nil, err
+	}
+	// 服务端在收到opt前不会再发送数据，bufio不会多读
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		logger.Error("read connect response failed,err:%v", err)
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("unexpected HTTP response: " + resp.Status)
+	}
+	return NewClient(conn, opt)
+}
+
+// DialHTTP 连接与http服务共用端口的rpc服务
+func DialHTTP(network, address string, opts ...*codec.Option) (*Client, error) {
+	return dialWithTimeOut(NewHTTPClient, network, address, opts...)
+}
+
+// XDial 按rpcAddr的协议连接，rpcAddr格式为protocol@addr，
+// 如 tcp@127.0.0.1:9999、unix@/tmp/zrpc.sock、http@127.0.0.1:8009、tls@127.0.0.1:9443；
+// tls使用opt.TLSConfig，为空时按系统根证书校验服务端
+func XDial(rpcAddr string, opts ...*codec.Option) (*Client, error) {
+	parts := strings.SplitN(rpcAddr, "@", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("rpc client err: wrong format '%s', expect protocol@addr", rpcAddr)
+	}
+	protocol, addr := parts[0], parts[1]
+	switch protocol {
+	case "http":
+		return DialHTTP("tcp", addr, opts...)
+	case "tls":
+		var config *tls.Config
+		if len(opts) > 0 && opts[0] != nil {
+			config = opts[0].TLSConfig
+		}
+		if config == nil {
+			config = &tls.Config{}
+		}
+		return DialTLS("tcp", addr, config, opts...)
+	default:
+		return Dial(protocol, addr, opts...)
+	}
+}
+
 // 关闭客户端：如果已关闭则报错，存在错误关闭
 func (c *Client) Close() error {
 	c.statusLock.Lock()
@@ -111,7 +192,19 @@ func (c *Client) Close() error {
 func (c *Client) IsAvailable() bool {
 	c.statusLock.Lock()
 	defer c.statusLock.Unlock()
-	return !c.closed && !c.shutDown
+	return !c.closed && !c.shutDown && !c.goAway
+}
+
+// Addr 服务端地址
+func (c *Client) Addr() string {
+	return c.addr
+}
+
+// Pending 已发出还未收到响应的调用数
+func (c *Client) Pending() int {
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
+	return len(c.pendingCall)
 }
 
 // 注册call，加入当前正在处理的call中
@@ -119,7 +212,7 @@ func (c *Client) registerCall(call *Call) (uint64, error) {
 	c.statusLock.Lock()
 	defer c.statusLock.Unlock()
 	// 对系统当前状态的判断
-	if c.closed || c.shutDown {
+	if c.closed || c.shutDown || c.goAway {
 		return 0, zrpc.ErrShutDown
 	}
 	call.Seq = c.currSeq
@@ -153,6 +246,12 @@ func (c *Client) terminateCall(err error) {
 		call.Error = err
 		call.done()
 	}
+	close(c.done)
+}
+
+// Done 连接断开（主动关闭或出错）后关闭，之后的调用都返回ErrShutDown
+func (c *Client) Done() <-chan struct{} {
+	return c.done
 }
 
 // 阻塞接收服务端的返回
@@ -165,21 +264,38 @@ func (c *Client) receive() {
 	for err == nil {
 		var header codec.Header
 		if err = c.cc.ReadHeader(&header); err != nil {
-			break
+			if !codec.IsDecodeError(err) {
+				break
+			}
+			// 帧是完整的，只有这一个call失败
+			header.Error = err.Error()
+		}
+		if header.Type == codec.TypeGoAway {
+			c.statusLock.Lock()
+			c.goAway = true
+			c.statusLock.Unlock()
+			err = c.cc.ReadBody(nil)
+			continue
 		}
 		call := c.removeCall(header.Seq)
+		if call != nil {
+			call.Trailer = header.Metadata
+		}
 
 		switch {
 		case call == nil:
 			err = c.cc.ReadBody(nil)
-		case header.Error != "":
-			call.Error = fmt.Errorf(header.Error)
+		case header.Error != "" || header.Code != 0:
+			call.Error = headerStatus(&header)
 			err = c.cc.ReadBody(nil)
 			call.done()
 		default:
 			err = c.cc.ReadBody(call.Reply)
 			if err != nil {
 				call.Error = errors.New("client read body failed," + err.Error())
+				if codec.IsDecodeError(err) {
+					err = nil
+				}
 			}
 			call.done()
 		}
@@ -187,6 +303,15 @@ func (c *Client) receive() {
 	c.terminateCall(err)
 }
 
+// headerStatus 还原服务端的zrpc.Status，没有状态码的错误（旧版本服务端）按CodeUnknown处理
+func headerStatus(header *codec.Header) *zrpc.Status {
+	code := zrpc.Code(header.Code)
+	if code == zrpc.CodeOK {
+		code = zrpc.CodeUnknown
+	}
+	return zrpc.NewStatus(code, header.Error, header.Details...)
+}
+
 // 发送请求到服务端
 func (c *Client) send(call *Call) {
 	c.sendingLock.Lock()
@@ -202,6 +327,18 @@ func (c *Client) send(call *Call) {
 	c.header.Seq = seq
 	c.header.ServiceMethod = call.ServiceMethod
 	c.header.Error = ""
+	c.header.Metadata = call.Metadata
+	c.header.Timeout = 0
+	if !call.Deadline.IsZero() {
+		if c.header.Timeout = time.Until(call.Deadline); c.header.Timeout <= 0 {
+			// 调用方已经不再等待，不必发送
+			if call := c.removeCall(seq); call != nil {
+				call.Error = zrpc.RpcClientCallServiceTimeOut
+				call.done()
+			}
+			return
+		}
+	}
 	if err = c.cc.Write(&c.header, call.Args); err != nil {
 		// 此次call写数据失败
 		// 移除
@@ -215,6 +352,11 @@ func (c *Client) send(call *Call) {
 
 // AsyncCall 暴露给客户端的接口，异步接口
 func (c *Client) AsyncCall(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
+	return c.AsyncCallContext(context.Background(), serviceMethod, args, reply, done)
+}
+
+// AsyncCallContext 异步接口，ctx中的outgoing metadata和deadline随请求发送
+func (c *Client) AsyncCallContext(ctx context.Context, serviceMethod string, args, reply interface{}, done chan *Call) *Call {
 	if done == nil {
 		done = make(chan *Call, 1)
 	} else if cap(done) == 0 {
@@ -227,18 +369,37 @@ func (c *Client) AsyncCall(serviceMethod string, args, reply interface{}, done c
 		Reply:         reply,
 		Done:          done,
 	}
+	call.Metadata, _ = metadata.FromOutgoingContext(ctx)
+	call.Deadline, _ = ctx.Deadline()
 	c.send(call)
 	return call
 }
 
-// SyncCall 暴露给客户端的接口，同步调用
+// SyncCall 暴露给客户端的接口，同步调用，依次经过WithInterceptors设置的拦截器
 func (c *Client) SyncCall(ctx context.Context, serviceMethod string, args, reply interface{}) error {
-	call := c.AsyncCall(serviceMethod, args, reply, make(chan *Call, 1))
+	return c.invoker(ctx, serviceMethod, args, reply)
+}
+
+func (c *Client) syncCall(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	call := c.AsyncCallContext(ctx, serviceMethod, args, reply, make(chan *Call, 1))
 	select {
 	case call := <-call.Done:
+		// 调用方通过metadata.WithTrailer接收trailer
+		_ = metadata.SetTrailer(ctx, call.Trailer)
 		return call.Error
 	case <-ctx.Done():
-		c.removeCall(call.Seq)
+		if c.removeCall(call.Seq) != nil {
+			c.cancelCall(call.Seq)
+		}
 		return zrpc.RpcClientCallServiceTimeOut
 	}
 }
+
+// cancelCall 通知服务端不再等待seq的结果，服务端取消处理且不再响应
+func (c *Client) cancelCall(seq uint64) {
+	c.sendingLock.Lock()
+	defer c.sendingLock.Unlock()
+	if err := c.cc.Write(&codec.Header{Seq: seq, Type: codec.TypeCancel}, nil); err != nil {
+		logger.Error("send cancel failed,err:%v", err)
+	}
+}
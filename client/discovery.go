@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"zrpc/codec"
+)
+
+// Discovery 把一个逻辑服务解析为当前可用的服务端地址
+type Discovery interface {
+	Refresh() error                      // 从数据源重新加载
+	Update(servers []Server) error       // 手动替换服务端列表
+	Get(mode SelectMode) (string, error) // 按mode选出一个地址，格式为protocol@addr
+	GetAll() ([]Server, error)
+}
+
+// StaticDiscovery 固定的服务端列表，不需要数据源，Refresh什么也不做
+type StaticDiscovery struct {
+	mu        sync.RWMutex
+	servers   []Server
+	selectors map[SelectMode]Selector // 每种mode各自维护轮询等状态
+}
+
+var _ Discovery = (*StaticDiscovery)(nil)
+
+func NewStaticDiscovery(servers []Server) *StaticDiscovery {
+	return &StaticDiscovery{
+		servers:   servers,
+		selectors: make(map[SelectMode]Selector),
+	}
+}
+
+// NewStaticDiscoveryAddrs 权重都为1的地址列表
+func NewStaticDiscoveryAddrs(addrs ...string) *StaticDiscovery {
+	servers := make([]Server, 0, len(addrs))
+	for _, addr := range addrs {
+		servers = append(servers, Server{Addr: addr})
+	}
+	return NewStaticDiscovery(servers)
+}
+
+func (d *StaticDiscovery) Refresh() error {
+	return nil
+}
+
+func (d *StaticDiscovery) Update(servers []Server) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.servers = servers
+	return nil
+}
+
+// Get 没有调用上下文，LeastPendingSelect总是选第一个，ConsistentHashSelect退化为随机；
+// 需要这两种模式时用xclient.XClient
+func (d *StaticDiscovery) Get(mode SelectMode) (string, error) {
+	d.mu.Lock()
+	selector, ok := d.selectors[mode]
+	if !ok {
+		selector = NewSelector(mode)
+		d.selectors[mode] = selector
+	}
+	servers := d.servers
+	d.mu.Unlock()
+	server, err := selector.Select(context.Background(), servers, func(string) int { return 0 })
+	if err != nil {
+		return "", err
+	}
+	return server.Addr, nil
+}
+
+// GetAll 返回的切片不能修改
+func (d *StaticDiscovery) GetAll() ([]Server, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.servers, nil
+}
+
+// DialDiscovery 从Discovery选出一个地址连接，代替写死地址的Dial
+func DialDiscovery(d Discovery, mode SelectMode, opts ...*codec.Option) (*Client, error) {
+	rpcAddr, err := d.Get(mode)
+	if err != nil {
+		return nil, err
+	}
+	return XDial(rpcAddr, opts...)
+}
@@ -0,0 +1,86 @@
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+	"zrpc/registry"
+)
+
+func TestStaticDiscovery(t *testing.T) {
+	d := NewStaticDiscoveryAddrs("tcp@a", "tcp@b")
+	first, _ := d.Get(RoundRobinSelect)
+	second, _ := d.Get(RoundRobinSelect)
+	_assert(first == "tcp@a" && second == "tcp@b", "unexpected round robin %s %s", first, second)
+
+	_ = d.Update(nil)
+	_, err := d.Get(RandomSelect)
+	_assert(err == ErrNoServers, "expect no servers, got %v", err)
+}
+
+func TestRegistryDiscovery(t *testing.T) {
+	r := registry.New(time.Minute)
+	var down int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		r.ServeHTTP(w, req)
+	}))
+	defer ts.Close()
+	_ = registry.SendHeartbeat(ts.URL, registry.ServerItem{Addr: "tcp@a", Services: []string{"Foo"}})
+
+	d := NewRegistryDiscovery(ts.URL, "Foo", 10*time.Millisecond)
+	servers, err := d.GetAll()
+	_assert(err == nil && len(servers) == 1 && servers[0].Addr == "tcp@a", "unexpected servers %v: %v", servers, err)
+
+	// an outage keeps serving the last known list
+	atomic.StoreInt32(&down, 1)
+	time.Sleep(20 * time.Millisecond)
+	_assert(d.Refresh() != nil, "expect the refresh to fail")
+	addr, err := d.Get(RandomSelect)
+	_assert(err == nil && addr == "tcp@a", "expect the cached server, got %q: %v", addr, err)
+
+	// without a list there is nothing to fall back on
+	_, err = NewRegistryDiscovery(ts.URL, "Foo", 0).GetAll()
+	_assert(err != nil, "expect an error before the first successful refresh")
+}
+
+func TestFileDiscovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrpc")
+	_assert(err == nil, "create temp dir failed: %v", err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	for name, contents := range map[string][2]string{
+		"servers.json": {`[{"addr": "tcp@a", "weight": 2}]`, `[{"addr": "tcp@a"}, {"addr": "tcp@b"}]`},
+		"servers.yaml": {"- addr: tcp@a\n  weight: 2\n", "- addr: tcp@a\n- addr: tcp@b\n"},
+	} {
+		path := filepath.Join(dir, name)
+		_ = ioutil.WriteFile(path, []byte(contents[0]), 0644)
+		d, err := NewFileDiscovery(path, 10*time.Millisecond)
+		_assert(err == nil, "%s: load failed: %v", name, err)
+		servers, _ := d.GetAll()
+		_assert(len(servers) == 1 && servers[0] == Server{Addr: "tcp@a", Weight: 2}, "%s: unexpected servers %v", name, servers)
+
+		// the file is reloaded when it changes
+		_ = ioutil.WriteFile(path, []byte(contents[1]), 0644)
+		for i := 0; i < 100 && len(servers) != 2; i++ {
+			time.Sleep(10 * time.Millisecond)
+			servers, _ = d.GetAll()
+		}
+		_assert(len(servers) == 2 && servers[1].Addr == "tcp@b", "%s: file was not reloaded: %v", name, servers)
+
+		// a broken file keeps the last good list
+		_ = ioutil.WriteFile(path, []byte("{"), 0644)
+		_assert(d.Refresh() != nil, "%s: expect parse error", name)
+		servers, _ = d.GetAll()
+		_assert(len(servers) == 2, "%s: lost servers after a bad reload: %v", name, servers)
+		_ = d.Close()
+	}
+}
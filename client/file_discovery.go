@@ -0,0 +1,113 @@
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"zrpc/logger"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultWatchInterval FileDiscovery检查文件变化的间隔
+const DefaultWatchInterval = time.Second
+
+// FileDiscovery 从本地文件读取服务端列表，文件变化后自动重新加载。
+// 文件内容为Server数组，.yaml/.yml按yaml解析，其他按json解析：
+//
+//	[{"addr": "tcp@127.0.0.1:9999", "weight": 2}, {"addr": "http@127.0.0.1:8009"}]
+type FileDiscovery struct {
+	*StaticDiscovery
+	path     string
+	interval time.Duration
+
+	mu      sync.Mutex // 保护modTime和size
+	modTime time.Time
+	size    int64
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+var _ Discovery = (*FileDiscovery)(nil)
+
+// NewFileDiscovery 立即加载一次文件，之后每interval检查一次，interval<=0时用DefaultWatchInterval
+func NewFileDiscovery(path string, interval time.Duration) (*FileDiscovery, error) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	d := &FileDiscovery{
+		StaticDiscovery: NewStaticDiscovery(nil),
+		path:            path,
+		interval:        interval,
+		done:            make(chan struct{}),
+	}
+	if err := d.Refresh(); err != nil {
+		return nil, err
+	}
+	go d.watch()
+	return d, nil
+}
+
+// Refresh 重新读取文件，解析失败时保留原来的列表
+func (d *FileDiscovery) Refresh() error {
+	info, err := os.Stat(d.path)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(d.path)
+	if err != nil {
+		return err
+	}
+	var servers []Server
+	switch filepath.Ext(d.path) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &servers)
+	default:
+		err = json.Unmarshal(data, &servers)
+	}
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	d.modTime, d.size = info.ModTime(), info.Size()
+	d.mu.Unlock()
+	return d.Update(servers)
+}
+
+// Close 停止监听文件
+func (d *FileDiscovery) Close() error {
+	d.closeOnce.Do(func() { close(d.done) })
+	return nil
+}
+
+func (d *FileDiscovery) watch() {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+		}
+		if !d.changed() {
+			continue
+		}
+		if err := d.Refresh(); err != nil {
+			logger.Error("reload discovery file %s failed,err:%v", d.path, err)
+		}
+	}
+}
+
+func (d *FileDiscovery) changed() bool {
+	info, err := os.Stat(d.path)
+	if err != nil {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return !info.ModTime().Equal(d.modTime) || info.Size() != d.size
+}
@@ -0,0 +1,37 @@
+package client
+
+import (
+	"context"
+	"zrpc/auth"
+)
+
+// Invoker 发出一次同步调用
+type Invoker func(ctx context.Context, serviceMethod string, args, reply interface{}) error
+
+// Interceptor 包裹SyncCall，调用next发出请求，可用于鉴权、日志、监控、重试等
+type Interceptor func(ctx context.Context, c *Client, serviceMethod string, args, reply interface{}, next Invoker) error
+
+// WithInterceptors 追加拦截器，先追加的在外层；需要在发起调用前设置
+func (c *Client) WithInterceptors(interceptors ...Interceptor) *Client {
+	c.interceptors = append(c.interceptors, interceptors...)
+	c.invoker = c.chainInterceptors(c.syncCall)
+	return c
+}
+
+func (c *Client) chainInterceptors(invoker Invoker) Invoker {
+	for i := len(c.interceptors) - 1; i >= 0; i-- {
+		ic, next := c.interceptors[i], invoker
+		invoker = func(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+			return ic(ctx, c, serviceMethod, args, reply, next)
+		}
+	}
+	return invoker
+}
+
+// CredentialInterceptor 每次调用前用credential生成凭证随metadata发送，
+// 用于和方法绑定、不能重复使用的凭证，如auth.SignHMAC
+func CredentialInterceptor(credential func(serviceMethod string) string) Interceptor {
+	return func(ctx context.Context, c *Client, serviceMethod string, args, reply interface{}, next Invoker) error {
+		return next(auth.WithCredential(ctx, credential(serviceMethod)), serviceMethod, args, reply)
+	}
+}
@@ -0,0 +1,276 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+	"zrpc"
+	"zrpc/codec"
+)
+
+type ConnState int
+
+const (
+	Connecting       ConnState = iota // 正在建立连接
+	Ready                             // 至少有一个连接可用
+	TransientFailure                  // 连接失败，等待重连
+	Shutdown                          // 已关闭
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case Connecting:
+		return "connecting"
+	case Ready:
+		return "ready"
+	case TransientFailure:
+		return "transient failure"
+	default:
+		return "shutdown"
+	}
+}
+
+// ManagedConfig ManagedClient的连接池和重连配置
+type ManagedConfig struct {
+	PoolSize   int           // 每个地址的连接数，<=0按1处理
+	MinBackoff time.Duration // 第一次重连前的等待
+	MaxBackoff time.Duration // 重连等待时间上限
+}
+
+var DefaultManagedConfig = ManagedConfig{
+	PoolSize:   1,
+	MinBackoff: 100 * time.Millisecond,
+	MaxBackoff: 10 * time.Second,
+}
+
+// ManagedClient 到一个地址的连接池，连接断开后按退避时间自动重连，调用轮流使用可用的连接
+type ManagedClient struct {
+	rpcAddr      string
+	opt          *codec.Option
+	cfg          ManagedConfig
+	interceptors []Interceptor
+	retry        *RetryPolicy
+	done         chan struct{} // Close时关闭
+
+	mu       sync.Mutex // 保护以下字段
+	conns    []managedConn
+	next     int // 轮询下标
+	closed   bool
+	changed  chan struct{} // 任意连接状态变化时关闭并替换
+	stateErr error         // 最近一次连接失败的原因
+}
+
+type managedConn struct {
+	c     *Client
+	state ConnState
+}
+
+// NewManagedClient 立即开始建立连接，rpcAddr格式为protocol@addr
+func NewManagedClient(rpcAddr string, cfg ManagedConfig, opts ...*codec.Option) (*ManagedClient, error) {
+	opt, err := codec.ParseOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.PoolSize <= 0 {
+		cfg.PoolSize = 1
+	}
+	mc := &ManagedClient{
+		rpcAddr: rpcAddr,
+		opt:     opt,
+		cfg:     cfg,
+		done:    make(chan struct{}),
+		conns:   make([]managedConn, cfg.PoolSize),
+		changed: make(chan struct{}),
+	}
+	for i := range mc.conns {
+		go mc.run(i)
+	}
+	return mc, nil
+}
+
+// WithInterceptors 每个连接的客户端都使用这些拦截器；需要在发起调用前设置
+func (mc *ManagedClient) WithInterceptors(interceptors ...Interceptor) *ManagedClient {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.interceptors = append(mc.interceptors, interceptors...)
+	for _, conn := range mc.conns {
+		if conn.c != nil {
+			conn.c.WithInterceptors(interceptors...)
+		}
+	}
+	return mc
+}
+
+// WithRetry 失败的调用按p重试，每次重试重新选择可用的连接，连接断开时等待重连；
+// 需要在发起调用前设置
+func (mc *ManagedClient) WithRetry(p *RetryPolicy) *ManagedClient {
+	mc.retry = p
+	return mc
+}
+
+// run 维护第i个连接：建立连接，断开后等待退避时间再重连，直到Close
+func (mc *ManagedClient) run(i int) {
+	for attempt := 0; ; {
+		c, err := XDial(mc.rpcAddr, mc.opt)
+		if err == nil {
+			mc.mu.Lock()
+			c.WithInterceptors(mc.interceptors...)
+			mc.mu.Unlock()
+			if !mc.setState(i, Ready, c, nil) {
+				_ = c.Close()
+				return
+			}
+			attempt = 0
+			select {
+			case <-c.Done():
+				err = fmt.Errorf("rpc client: connection to %s lost: %w", mc.rpcAddr, zrpc.ErrShutDown)
+			case <-mc.done:
+				return
+			}
+		}
+		if !mc.setState(i, TransientFailure, nil, err) {
+			return
+		}
+		attempt++
+		timer := time.NewTimer(expBackoff(attempt, mc.cfg.MinBackoff, mc.cfg.MaxBackoff, 1.6, 0.2))
+		select {
+		case <-mc.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if !mc.setState(i, Connecting, nil, nil) {
+			return
+		}
+	}
+}
+
+// setState 返回false时ManagedClient已关闭
+func (mc *ManagedClient) setState(i int, state ConnState, c *Client, err error) bool {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mc.closed {
+		return false
+	}
+	mc.conns[i] = managedConn{c: c, state: state}
+	if err != nil {
+		mc.stateErr = err
+	}
+	close(mc.changed)
+	mc.changed = make(chan struct{})
+	return true
+}
+
+// State 有可用连接时为Ready，否则有正在连接的为Connecting
+func (mc *ManagedClient) State() ConnState {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.stateLocked()
+}
+
+func (mc *ManagedClient) stateLocked() ConnState {
+	if mc.closed {
+		return Shutdown
+	}
+	state := TransientFailure
+	for _, conn := range mc.conns {
+		if conn.state == Ready && conn.c.IsAvailable() {
+			return Ready
+		}
+		// 收到go away的连接很快会断开重连
+		if conn.state == Connecting || conn.state == Ready {
+			state = Connecting
+		}
+	}
+	return state
+}
+
+// WaitForStateChange 等待状态不再是from，ctx结束时返回false
+func (mc *ManagedClient) WaitForStateChange(ctx context.Context, from ConnState) bool {
+	for {
+		mc.mu.Lock()
+		state, changed := mc.stateLocked(), mc.changed
+		mc.mu.Unlock()
+		if state != from {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-changed:
+		}
+	}
+}
+
+// pick 轮流选出一个可用的客户端；没有时返回当前状态，连接失败时同时返回原因
+func (mc *ManagedClient) pick() (*Client, ConnState, chan struct{}, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	for n := 0; n < len(mc.conns); n++ {
+		mc.next = (mc.next + 1) % len(mc.conns)
+		conn := mc.conns[mc.next]
+		if conn.state == Ready && conn.c.IsAvailable() {
+			return conn.c, Ready, nil, nil
+		}
+	}
+	return nil, mc.stateLocked(), mc.changed, mc.stateErr
+}
+
+// SyncCall 连接中时等待连接建立，连接失败等待重连时立即返回错误；
+// 单次调用的重试策略通过WithRetryPolicy设置
+func (mc *ManagedClient) SyncCall(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	return RetryPolicyFromContext(ctx, mc.retry).Do(ctx, serviceMethod, func(ctx context.Context) error {
+		return mc.call(ctx, serviceMethod, args, reply)
+	})
+}
+
+func (mc *ManagedClient) call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	for {
+		c, state, changed, err := mc.pick()
+		switch state {
+		case Ready:
+			return c.SyncCall(ctx, serviceMethod, args, reply)
+		case Shutdown:
+			return zrpc.ErrShutDown
+		case TransientFailure:
+			return fmt.Errorf("rpc client: %s unavailable: %w", mc.rpcAddr, err)
+		}
+		select {
+		case <-ctx.Done():
+			return zrpc.RpcClientCallServiceTimeOut
+		case <-changed:
+		}
+	}
+}
+
+// Pending 所有连接上进行中的调用数
+func (mc *ManagedClient) Pending() int {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	n := 0
+	for _, conn := range mc.conns {
+		if conn.c != nil {
+			n += conn.c.Pending()
+		}
+	}
+	return n
+}
+
+// Close 关闭所有连接并停止重连
+func (mc *ManagedClient) Close() error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mc.closed {
+		return zrpc.ErrShutDown
+	}
+	mc.closed = true
+	close(mc.done)
+	close(mc.changed)
+	for _, conn := range mc.conns {
+		if conn.c != nil {
+			_ = conn.c.Close()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+	"zrpc/server"
+)
+
+type Foo int
+
+type Args struct{ Num1, Num2 int }
+
+func (f Foo) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+// Sleep 睡眠args.Num1毫秒
+func (f Foo) Sleep(args Args, reply *int) error {
+	time.Sleep(time.Duration(args.Num1) * time.Millisecond)
+	return nil
+}
+
+func startServer(addr string) *server.Server {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		panic(err)
+	}
+	return startServerOn(l)
+}
+
+func startServerOn(l net.Listener) *server.Server {
+	s := server.NewServer()
+	_ = s.RegisterService(new(Foo))
+	go s.Accept(l)
+	return s
+}
+
+func waitForState(mc *ManagedClient, state ConnState) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for mc.State() != state {
+		if !mc.WaitForStateChange(ctx, mc.State()) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestManagedClient_Reconnect(t *testing.T) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	_ = l.Close()
+	s := startServer(addr)
+
+	mc, err := NewManagedClient("tcp@"+addr, ManagedConfig{PoolSize: 2, MinBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond})
+	_assert(err == nil, "new managed client failed: %v", err)
+	defer func() { _ = mc.Close() }()
+
+	// calls wait while the pool is connecting
+	var reply int
+	err = mc.SyncCall(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "call Foo.Sum failed: %v", err)
+	_assert(mc.State() == Ready, "expect ready, got %v", mc.State())
+
+	// losing the server fails calls fast instead of returning ErrShutDown forever
+	_ = s.Close()
+	_assert(waitForState(mc, TransientFailure), "expect transient failure, got %v", mc.State())
+	err = mc.SyncCall(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err != nil && IsRetryable(err), "expect a retryable unavailable error, got %v", err)
+
+	// the pool redials once the server is back
+	s = startServer(addr)
+	defer func() { _ = s.Close() }()
+	_assert(waitForState(mc, Ready), "did not reconnect, state %v", mc.State())
+	err = mc.SyncCall(context.Background(), "Foo.Sum", &Args{Num1: 2, Num2: 2}, &reply)
+	_assert(err == nil && reply == 4, "call after reconnect failed: %v", err)
+
+	_ = mc.Close()
+	_assert(mc.State() == Shutdown, "expect shutdown, got %v", mc.State())
+}
+
+func TestManagedClient_Retry(t *testing.T) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	_ = l.Close()
+	s := startServer(addr)
+
+	policy := &RetryPolicy{MaxAttempts: 20, InitialBackoff: 20 * time.Millisecond, MaxBackoff: 50 * time.Millisecond, Multiplier: 1.5, IdempotentMethods: []string{"Foo.*"}}
+	mc, err := NewManagedClient("tcp@"+addr, ManagedConfig{MinBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+	_assert(err == nil, "new managed client failed: %v", err)
+	defer func() { _ = mc.Close() }()
+	mc.WithRetry(policy)
+	_assert(waitForState(mc, Ready), "expect ready, got %v", mc.State())
+
+	// the retries pick up the new connection once the server is back
+	_ = s.Close()
+	_assert(waitForState(mc, TransientFailure), "expect transient failure, got %v", mc.State())
+	restarted := make(chan *server.Server, 1)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		restarted <- startServer(addr)
+	}()
+	var reply int
+	err = mc.SyncCall(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "call across the restart failed: %v", err)
+	_ = (<-restarted).Close()
+
+	// a plain Client is not retried once its connection is gone
+	s = startServer(addr)
+	c, err := XDial("tcp@" + addr)
+	_assert(err == nil, "dial failed: %v", err)
+	defer func() { _ = c.Close() }()
+	attempts := 0
+	c.WithInterceptors(RetryInterceptor(policy), func(ctx context.Context, c *Client, serviceMethod string, args, reply interface{}, next Invoker) error {
+		attempts++
+		return next(ctx, serviceMethod, args, reply)
+	})
+	_ = s.Close()
+	for i := 0; i < 100 && c.IsAvailable(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	err = c.SyncCall(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err != nil && attempts == 1, "expect one attempt on a dead client, got %d: %v", attempts, err)
+}
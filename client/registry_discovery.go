@@ -0,0 +1,113 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+	"zrpc/logger"
+	"zrpc/registry"
+)
+
+// DefaultUpdateTimeout RegistryDiscovery缓存服务端列表的时间
+const DefaultUpdateTimeout = 10 * time.Second
+
+// RegistryDiscovery 从registry包的注册中心拉取服务端列表，超过timeout后在下次Get时刷新；
+// 刷新失败时继续使用上一次拉取到的列表，timeout后再重试
+type RegistryDiscovery struct {
+	*StaticDiscovery
+	registryURL string // 带上?service=Name后的完整地址
+	timeout     time.Duration
+
+	mu          sync.Mutex
+	lastUpdate  time.Time
+	nextRefresh time.Time
+}
+
+var _ Discovery = (*RegistryDiscovery)(nil)
+
+// NewRegistryDiscovery service为空时返回注册中心的全部服务端，timeout<=0时用DefaultUpdateTimeout
+func NewRegistryDiscovery(registryURL, service string, timeout time.Duration) *RegistryDiscovery {
+	if timeout <= 0 {
+		timeout = DefaultUpdateTimeout
+	}
+	if service != "" {
+		registryURL += "?service=" + url.QueryEscape(service)
+	}
+	return &RegistryDiscovery{
+		StaticDiscovery: NewStaticDiscovery(nil),
+		registryURL:     registryURL,
+		timeout:         timeout,
+	}
+}
+
+func (d *RegistryDiscovery) Update(servers []Server) error {
+	d.mu.Lock()
+	d.lastUpdate = time.Now()
+	d.nextRefresh = d.lastUpdate.Add(d.timeout)
+	d.mu.Unlock()
+	return d.StaticDiscovery.Update(servers)
+}
+
+// Refresh 缓存未过期时不请求注册中心
+func (d *RegistryDiscovery) Refresh() error {
+	d.mu.Lock()
+	fresh := d.nextRefresh.After(time.Now())
+	d.mu.Unlock()
+	if fresh {
+		return nil
+	}
+	servers, err := d.fetch()
+	if err != nil {
+		logger.Error("rpc registry refresh failed,err:%v", err)
+		return err
+	}
+	return d.Update(servers)
+}
+
+func (d *RegistryDiscovery) fetch() ([]Server, error) {
+	resp, err := registry.HTTPClient.Get(d.registryURL)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rpc registry: unexpected status %s", resp.Status)
+	}
+	var servers []Server
+	if err = json.NewDecoder(resp.Body).Decode(&servers); err != nil {
+		return nil, err
+	}
+	return servers, nil
+}
+
+// refresh 刷新失败但已有拉取到的列表时不报错，等timeout后再重试
+func (d *RegistryDiscovery) refresh() error {
+	err := d.Refresh()
+	if err == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.lastUpdate.IsZero() {
+		return err
+	}
+	d.nextRefresh = time.Now().Add(d.timeout)
+	return nil
+}
+
+func (d *RegistryDiscovery) Get(mode SelectMode) (string, error) {
+	if err := d.refresh(); err != nil {
+		return "", err
+	}
+	return d.StaticDiscovery.Get(mode)
+}
+
+func (d *RegistryDiscovery) GetAll() ([]Server, error) {
+	if err := d.refresh(); err != nil {
+		return nil, err
+	}
+	return d.StaticDiscovery.GetAll()
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"path"
+	"syscall"
+	"time"
+	"zrpc"
+)
+
+// RetryPolicy 失败后的重试策略，只有幂等的方法才会重试
+type RetryPolicy struct {
+	MaxAttempts    int           // 包括第一次调用，<=1时不重试
+	InitialBackoff time.Duration // 第一次重试前的等待
+	MaxBackoff     time.Duration // 等待时间上限，0表示不限制
+	Multiplier     float64       // 每次重试等待时间的倍数，<1按1处理
+	Jitter         float64       // 等待时间随机浮动的比例，0~1
+
+	// IdempotentMethods 可以重试的方法，支持path.Match的模式，如 "Foo.Get"、"Cache.*"；
+	// 也可以用WithIdempotent标记单次调用
+	IdempotentMethods []string
+	// Retryable 判断错误是否可以重试，nil时用IsRetryable
+	Retryable func(err error) bool
+}
+
+var DefaultRetryPolicy = &RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 50 * time.Millisecond,
+	MaxBackoff:     time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+var retryableErrors = []error{
+	zrpc.ErrShutDown, zrpc.ErrCircuitOpen, zrpc.ErrServerOverloaded, io.EOF, io.ErrUnexpectedEOF,
+	syscall.ECONNRESET, syscall.ECONNREFUSED, syscall.EPIPE,
+}
+
+// IsRetryable 连接层面的错误可以重试：连接已关闭、被重置、被拒绝、熔断打开等，
+// 以及服务端过载时拒绝执行的请求；服务端返回的其他错误和超时都不重试
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, target := range retryableErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
+
+type (
+	retryPolicyKey struct{}
+	idempotentKey  struct{}
+)
+
+// WithRetryPolicy 单次调用使用p代替RetryInterceptor的策略，p为nil时不重试
+func WithRetryPolicy(ctx context.Context, p *RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyKey{}, p)
+}
+
+// WithIdempotent 标记这次调用是幂等的，可以重试
+func WithIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+// RetryPolicyFromContext ctx中的策略优先于p
+func RetryPolicyFromContext(ctx context.Context, p *RetryPolicy) *RetryPolicy {
+	if cp, ok := ctx.Value(retryPolicyKey{}).(*RetryPolicy); ok {
+		return cp
+	}
+	return p
+}
+
+// RetryInterceptor 按p重试失败的调用，每次重试都会注册新的Call；
+// p为nil时只有通过WithRetryPolicy设置了策略的调用才会重试。
+// 重试仍使用同一个Client，连接断开后Client不再可用，不会再重试；
+// 需要换新连接重试时用XClient.WithRetry或ManagedClient.WithRetry
+func RetryInterceptor(p *RetryPolicy) Interceptor {
+	return func(ctx context.Context, c *Client, serviceMethod string, args, reply interface{}, next Invoker) error {
+		policy := RetryPolicyFromContext(ctx, p)
+		if policy == nil {
+			return next(ctx, serviceMethod, args, reply)
+		}
+		sameClient := *policy
+		sameClient.Retryable = func(err error) bool {
+			return c.IsAvailable() && policy.retryable(err)
+		}
+		return sameClient.Do(ctx, serviceMethod, func(ctx context.Context) error {
+			return next(ctx, serviceMethod, args, reply)
+		})
+	}
+}
+
+// Do 调用call直到成功、错误不可重试、达到MaxAttempts，或剩余时间不够再等待一次
+func (p *RetryPolicy) Do(ctx context.Context, serviceMethod string, call func(ctx context.Context) error) error {
+	if p == nil || !p.idempotent(ctx, serviceMethod) {
+		return call(ctx)
+	}
+	for attempt := 1; ; attempt++ {
+		err := call(ctx)
+		if err == nil || attempt >= p.MaxAttempts || !p.retryable(err) {
+			return err
+		}
+		backoff := p.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= backoff {
+			return err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func (p *RetryPolicy) idempotent(ctx context.Context, serviceMethod string) bool {
+	if marked, _ := ctx.Value(idempotentKey{}).(bool); marked {
+		return true
+	}
+	for _, pattern := range p.IdempotentMethods {
+		if ok, _ := path.Match(pattern, serviceMethod); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	return expBackoff(attempt, p.InitialBackoff, p.MaxBackoff, p.Multiplier, p.Jitter)
+}
+
+// expBackoff 第attempt次失败后的等待时间：指数增长，带随机浮动
+func expBackoff(attempt int, initial, max time.Duration, multiplier, jitter float64) time.Duration {
+	backoff := float64(initial) * math.Pow(math.Max(multiplier, 1), float64(attempt-1))
+	if max > 0 && backoff > float64(max) {
+		backoff = float64(max)
+	}
+	backoff *= 1 + jitter*(rand.Float64()*2-1)
+	return time.Duration(backoff)
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"zrpc"
+)
+
+func TestRetryPolicy_Do(t *testing.T) {
+	p := &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2, IdempotentMethods: []string{"Foo.*"}}
+	attempts := 0
+	shutDown := func(context.Context) error {
+		attempts++
+		return zrpc.ErrShutDown
+	}
+
+	err := p.Do(context.Background(), "Foo.Get", shutDown)
+	_assert(err == zrpc.ErrShutDown && attempts == 3, "expect 3 attempts, got %d: %v", attempts, err)
+
+	// only idempotent methods are retried
+	attempts = 0
+	_ = p.Do(context.Background(), "Bar.Set", shutDown)
+	_assert(attempts == 1, "non idempotent method retried %d times", attempts)
+	attempts = 0
+	_ = p.Do(WithIdempotent(context.Background()), "Bar.Set", shutDown)
+	_assert(attempts == 3, "call marked idempotent was not retried: %d", attempts)
+
+	// errors returned by the server are final
+	attempts = 0
+	_ = p.Do(context.Background(), "Foo.Get", func(context.Context) error {
+		attempts++
+		return errors.New("not found")
+	})
+	_assert(attempts == 1, "server error retried %d times", attempts)
+
+	// no retry when the deadline leaves no room for the backoff
+	attempts = 0
+	slow := &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second, IdempotentMethods: []string{"Foo.*"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_ = slow.Do(ctx, "Foo.Get", shutDown)
+	_assert(attempts == 1, "retried past the deadline: %d", attempts)
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := &RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond, Multiplier: 2, Jitter: 0.1}
+	for attempt, want := range []time.Duration{100, 200, 300, 300} {
+		want *= time.Millisecond
+		got := p.backoff(attempt + 1)
+		_assert(got >= want*9/10 && got <= want*11/10, "attempt %d: backoff %v, want about %v", attempt+1, got, want)
+	}
+}
@@ -0,0 +1,196 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNoServers = errors.New("rpc discovery: no available servers")
+
+type SelectMode int
+
+const (
+	RandomSelect             SelectMode = iota // 随机
+	RoundRobinSelect                           // 轮询
+	WeightedRoundRobinSelect                   // 平滑加权轮询，按Server.Weight
+	LeastPendingSelect                         // 进行中调用最少的
+	ConsistentHashSelect                       // 按WithHashKey设置的key一致性哈希，没有key时随机
+)
+
+// Server 一个服务端，Addr格式为protocol@addr，Weight只用于加权轮询，<=0按1处理
+type Server struct {
+	Addr   string `json:"addr" yaml:"addr"`
+	Weight int    `json:"weight,omitempty" yaml:"weight,omitempty"`
+}
+
+// Selector 每次调用选出一个服务端，pending返回该地址进行中的调用数；
+// 实现需要并发安全
+type Selector interface {
+	Select(ctx context.Context, servers []Server, pending func(addr string) int) (Server, error)
+}
+
+func NewSelector(mode SelectMode) Selector {
+	switch mode {
+	case RoundRobinSelect:
+		return new(roundRobinSelector)
+	case WeightedRoundRobinSelect:
+		return &weightedSelector{current: make(map[string]int)}
+	case LeastPendingSelect:
+		return leastPendingSelector{}
+	case ConsistentHashSelect:
+		return &hashSelector{random: newRandomSelector()}
+	default:
+		return newRandomSelector()
+	}
+}
+
+type randomSelector struct {
+	mu sync.Mutex // rand.Rand不是并发安全的
+	r  *rand.Rand
+}
+
+func newRandomSelector() *randomSelector {
+	return &randomSelector{r: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+func (s *randomSelector) Select(_ context.Context, servers []Server, _ func(string) int) (Server, error) {
+	if len(servers) == 0 {
+		return Server{}, ErrNoServers
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return servers[s.r.Intn(len(servers))], nil
+}
+
+type roundRobinSelector struct {
+	mu    sync.Mutex
+	index int
+}
+
+func (s *roundRobinSelector) Select(_ context.Context, servers []Server, _ func(string) int) (Server, error) {
+	if len(servers) == 0 {
+		return Server{}, ErrNoServers
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.index = s.index % len(servers)
+	server := servers[s.index]
+	s.index++
+	return server, nil
+}
+
+// weightedSelector nginx的平滑加权轮询：每次所有节点加上自身权重，选出当前值最大的，
+// 再减去总权重
+type weightedSelector struct {
+	mu      sync.Mutex
+	current map[string]int
+}
+
+func (s *weightedSelector) Select(_ context.Context, servers []Server, _ func(string) int) (Server, error) {
+	if len(servers) == 0 {
+		return Server{}, ErrNoServers
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total, best := 0, -1
+	seen := make(map[string]bool, len(servers))
+	for i, server := range servers {
+		weight := server.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		total += weight
+		s.current[server.Addr] += weight
+		seen[server.Addr] = true
+		if best < 0 || s.current[server.Addr] > s.current[servers[best].Addr] {
+			best = i
+		}
+	}
+	s.current[servers[best].Addr] -= total
+	// 已下线的节点不再保留状态
+	for addr := range s.current {
+		if !seen[addr] {
+			delete(s.current, addr)
+		}
+	}
+	return servers[best], nil
+}
+
+type leastPendingSelector struct{}
+
+func (leastPendingSelector) Select(_ context.Context, servers []Server, pending func(string) int) (Server, error) {
+	if len(servers) == 0 {
+		return Server{}, ErrNoServers
+	}
+	best, least := 0, pending(servers[0].Addr)
+	for i := 1; i < len(servers); i++ {
+		if n := pending(servers[i].Addr); n < least {
+			best, least = i, n
+		}
+	}
+	return servers[best], nil
+}
+
+type hashKey struct{}
+
+// WithHashKey ConsistentHashSelect下相同key的调用落到同一个服务端
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKey{}, key)
+}
+
+// hashReplicas 每个服务端在哈希环上的虚拟节点数
+const hashReplicas = 64
+
+type hashSelector struct {
+	mu      sync.Mutex
+	servers string // 构建ring时的服务端列表，变化时重建
+	ring    []uint32
+	nodes   map[uint32]Server
+	random  *randomSelector
+}
+
+func (s *hashSelector) Select(ctx context.Context, servers []Server, pending func(string) int) (Server, error) {
+	key, ok := ctx.Value(hashKey{}).(string)
+	if !ok {
+		return s.random.Select(ctx, servers, pending)
+	}
+	if len(servers) == 0 {
+		return Server{}, ErrNoServers
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.build(servers)
+	h := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(s.ring), func(i int) bool { return s.ring[i] >= h })
+	return s.nodes[s.ring[i%len(s.ring)]], nil
+}
+
+func (s *hashSelector) build(servers []Server) {
+	addrs := make([]string, 0, len(servers))
+	for _, server := range servers {
+		addrs = append(addrs, server.Addr)
+	}
+	sort.Strings(addrs)
+	id := strings.Join(addrs, ",")
+	if id == s.servers {
+		return
+	}
+	s.servers = id
+	s.ring = make([]uint32, 0, len(servers)*hashReplicas)
+	s.nodes = make(map[uint32]Server, len(servers)*hashReplicas)
+	for _, server := range servers {
+		for i := 0; i < hashReplicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + server.Addr))
+			s.ring = append(s.ring, h)
+			s.nodes[h] = server
+		}
+	}
+	sort.Slice(s.ring, func(i, j int) bool { return s.ring[i] < s.ring[j] })
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"zrpc/logger"
+)
+
+func init() {
+	logger.SetLevel(logger.LevelNone)
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+var testServers = []Server{{Addr: "a", Weight: 5}, {Addr: "b", Weight: 1}, {Addr: "c", Weight: 1}}
+
+func noPending(string) int { return 0 }
+
+func TestSelector_RoundRobin(t *testing.T) {
+	s := NewSelector(RoundRobinSelect)
+	for i := 0; i < 6; i++ {
+		server, err := s.Select(context.Background(), testServers, noPending)
+		_assert(err == nil && server == testServers[i%3], "unexpected server %v: %v", server, err)
+	}
+	_, err := s.Select(context.Background(), nil, noPending)
+	_assert(err == ErrNoServers, "expect no servers, got %v", err)
+}
+
+func TestSelector_WeightedRoundRobin(t *testing.T) {
+	s := NewSelector(WeightedRoundRobinSelect)
+	var picked string
+	for i := 0; i < 7; i++ {
+		server, _ := s.Select(context.Background(), testServers, noPending)
+		picked += server.Addr
+	}
+	// smooth: the heavy server is not picked 5 times in a row
+	_assert(picked == "aabacaa", "unexpected order %s", picked)
+}
+
+func TestSelector_LeastPending(t *testing.T) {
+	s := NewSelector(LeastPendingSelect)
+	pending := map[string]int{"a": 3, "b": 1, "c": 2}
+	server, _ := s.Select(context.Background(), testServers, func(addr string) int { return pending[addr] })
+	_assert(server.Addr == "b", "unexpected server %v", server)
+}
+
+func TestSelector_ConsistentHash(t *testing.T) {
+	s := NewSelector(ConsistentHashSelect)
+	ctx := WithHashKey(context.Background(), "user-42")
+	first, _ := s.Select(ctx, testServers, noPending)
+	for i := 0; i < 10; i++ {
+		server, _ := s.Select(ctx, testServers, noPending)
+		_assert(server == first, "same key moved from %v to %v", first, server)
+	}
+	// removing another server keeps the key where it was
+	var rest []Server
+	for _, server := range testServers {
+		if server != first {
+			rest = append(rest, server)
+			break
+		}
+	}
+	rest = append(rest, first)
+	server, _ := s.Select(ctx, rest, noPending)
+	_assert(server == first, "key moved from %v to %v", first, server)
+}
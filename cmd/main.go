@@ -50,7 +50,8 @@ func main() {
 
 	time.Sleep(time.Second)
 
-	ctx, _ := context.WithTimeout(context.Background(), time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
 	// send request & receive response
 	var wg sync.WaitGroup
 	for i := 0; i < 5; i++ {
@@ -1,17 +1,41 @@
 package codec
 
-import "io"
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	JsonType    = "application/json"
+	GobType     = "application/gob"
+	ProtoType   = "application/protobuf"
+	MsgpackType = "application/msgpack"
+)
+
+// MessageType kind of a frame, calls are requests and their responses,
+// the other types are bodiless control messages
+type MessageType uint8
 
 const (
-	JsonType = "application/json"
-	GobType  = "application/gob"
+	TypeCall   MessageType = iota
+	TypeCancel             // client -> server: stop handling the call with Seq
+	TypeGoAway             // server -> client: stop sending new calls, pending calls are still answered
 )
 
 // Header call ("service.method", in, out)
 type Header struct {
-	ServiceMethod string // "Example.New" implement by Go "reflect"
-	Seq           uint64 // request seq number for client
-	Error         string
+	ServiceMethod string      `json:"service_method,omitempty"` // "Example.New" implement by Go "reflect"
+	Seq           uint64      `json:"-"`                        // request seq number for client, carried by the frame
+	Type          MessageType `json:"-"`                        // carried by the frame flags
+	Error         string      `json:"error,omitempty"`
+	// Code and Details of the zrpc.Status the error is rebuilt into on the client
+	Code    uint32   `json:"code,omitempty"`
+	Details []string `json:"details,omitempty"`
+	// Timeout how long the caller is still waiting, the server stops handling the request after it
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// Metadata request key/values sent by the client, on a response the trailer set by the service
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 // Codec codec interface for extension
@@ -31,4 +55,34 @@ func init() {
 	NewCodecFuncMap = make(map[string]NewCodecFunc)
 	NewCodecFuncMap[GobType] = NewGobCodec
 	NewCodecFuncMap[JsonType] = NewJsonCodec
+	NewCodecFuncMap[ProtoType] = NewProtoCodec
+	NewCodecFuncMap[MsgpackType] = NewMsgpackCodec
+}
+
+// compressible codecs that can compress bodies, see FrameCodec
+type compressible interface {
+	SetCompressor(comp Compressor, threshold int)
+}
+
+// NewCodec builds the codec negotiated by opt on conn
+func NewCodec(conn io.ReadWriteCloser, opt *Option) (Codec, error) {
+	codecFunc := NewCodecFuncMap[opt.CodecType]
+	if codecFunc == nil {
+		return nil, fmt.Errorf("codec: not found codec type %q", opt.CodecType)
+	}
+	var comp Compressor
+	if opt.Compression != CompressNone {
+		if comp = CompressorMap[opt.Compression]; comp == nil {
+			return nil, fmt.Errorf("codec: not found compression %q", opt.Compression)
+		}
+	}
+	cc := codecFunc(conn)
+	if comp != nil {
+		c, ok := cc.(compressible)
+		if !ok {
+			return nil, fmt.Errorf("codec: %s does not support compression", opt.CodecType)
+		}
+		c.SetCompressor(comp, opt.CompressThreshold)
+	}
+	return cc, nil
 }
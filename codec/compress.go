@@ -0,0 +1,125 @@
+package codec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	CompressNone   = ""
+	CompressGzip   = "gzip"
+	CompressSnappy = "snappy"
+	CompressZstd   = "zstd"
+)
+
+// FlagCompressed the frame body is compressed by the negotiated Compressor
+const FlagCompressed uint8 = 1 << 0
+
+// Compressor compresses whole bodies, implementations must be safe for concurrent use
+type Compressor interface {
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// CompressorMap compressors selectable by Option.Compression
+var CompressorMap = map[string]Compressor{
+	CompressGzip:   new(gzipCompressor),
+	CompressSnappy: snappyCompressor{},
+	CompressZstd:   new(zstdCompressor),
+}
+
+var errDecompressedTooLarge = errors.New("codec: decompressed body too large")
+
+type gzipCompressor struct {
+	writers sync.Pool
+}
+
+func (g *gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, ok := g.writers.Get().(*gzip.Writer)
+	if ok {
+		w.Reset(&buf)
+	} else {
+		w = gzip.NewWriter(&buf)
+	}
+	defer g.writers.Put(w)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (g *gzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+	// never inflate past MaxBodySize
+	out, err := ioutil.ReadAll(io.LimitReader(r, int64(MaxBodySize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > int(MaxBodySize) {
+		return nil, errDecompressedTooLarge
+	}
+	return out, nil
+}
+
+type snappyCompressor struct{}
+
+func (snappyCompressor) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+func (snappyCompressor) Decompress(data []byte) ([]byte, error) {
+	n, err := snappy.DecodedLen(data)
+	if err != nil {
+		return nil, err
+	}
+	if n > int(MaxBodySize) {
+		return nil, errDecompressedTooLarge
+	}
+	return snappy.Decode(nil, data)
+}
+
+type zstdCompressor struct {
+	once sync.Once
+	enc  *zstd.Encoder
+	dec  *zstd.Decoder
+	err  error
+}
+
+func (z *zstdCompressor) init() error {
+	z.once.Do(func() {
+		if z.enc, z.err = zstd.NewWriter(nil); z.err != nil {
+			return
+		}
+		z.dec, z.err = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(uint64(MaxBodySize)))
+	})
+	return z.err
+}
+
+func (z *zstdCompressor) Compress(data []byte) ([]byte, error) {
+	if err := z.init(); err != nil {
+		return nil, err
+	}
+	return z.enc.EncodeAll(data, nil), nil
+}
+
+func (z *zstdCompressor) Decompress(data []byte) ([]byte, error) {
+	if err := z.init(); err != nil {
+		return nil, err
+	}
+	return z.dec.DecodeAll(data, nil)
+}
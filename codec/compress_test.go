@@ -0,0 +1,57 @@
+package codec
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCompressor(t *testing.T) {
+	data := []byte(strings.Repeat("zrpc compress ", 200))
+	for name, comp := range CompressorMap {
+		out, err := comp.Compress(data)
+		if err != nil || len(out) >= len(data) {
+			t.Fatalf("%s: compress failed: %v, %d bytes", name, err, len(out))
+		}
+		in, err := comp.Decompress(out)
+		if err != nil || !bytes.Equal(in, data) {
+			t.Fatalf("%s: decompress failed: %v", name, err)
+		}
+	}
+}
+
+func TestFrameCodec_Compression(t *testing.T) {
+	for name := range CompressorMap {
+		conn := new(bufConn)
+		cc, err := NewCodec(conn, &Option{CodecType: JsonType, Compression: name, CompressThreshold: 64})
+		if err != nil {
+			t.Fatalf("%s: new codec failed: %v", name, err)
+		}
+		small, large := "small", strings.Repeat("large ", 100)
+		_ = cc.Write(&Header{Seq: 1}, small)
+		_ = cc.Write(&Header{Seq: 2}, large)
+
+		// only the body above the threshold is flagged
+		raw := bytes.NewReader(conn.Bytes())
+		f1, _ := ReadFrame(raw)
+		f2, _ := ReadFrame(raw)
+		if f1.Flags&FlagCompressed != 0 || f2.Flags&FlagCompressed == 0 {
+			t.Fatalf("%s: unexpected flags %d %d", name, f1.Flags, f2.Flags)
+		}
+
+		var h Header
+		var body string
+		for _, want := range []string{small, large} {
+			if err = cc.ReadHeader(&h); err != nil {
+				t.Fatalf("%s: read header failed: %v", name, err)
+			}
+			if err = cc.ReadBody(&body); err != nil || body != want {
+				t.Fatalf("%s: read body failed: %v", name, err)
+			}
+		}
+	}
+
+	if _, err := NewCodec(new(bufConn), &Option{CodecType: JsonType, Compression: "lz4"}); err == nil {
+		t.Fatal("expect unknown compression error")
+	}
+}
@@ -0,0 +1,297 @@
+package codec
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"zrpc/logger"
+)
+
+// Frame layout, all fields big endian:
+//
+//	magic(2) version(1) flags(1) header length(4) body length(4) seq(8) | header | body
+//
+// Flags: bit 0 FlagCompressed, bits 4-7 the MessageType.
+// The header is always json encoded, the body uses the negotiated Serializer.
+// Every frame carries its own lengths, so a bad message is skipped on its own
+// and proxies can forward frames without decoding them.
+const (
+	FrameMagic      uint16 = 0x7a72 // "zr"
+	FrameVersion    uint8  = 1
+	FrameHeaderSize        = 20
+)
+
+var (
+	// MaxHeaderSize a larger header means the stream is broken
+	MaxHeaderSize uint32 = 1 << 20
+	// MaxBodySize larger bodies are skipped and reported as a DecodeError
+	MaxBodySize uint32 = 64 << 20
+)
+
+var (
+	ErrBadMagic       = errors.New("codec: invalid frame magic")
+	ErrBadVersion     = errors.New("codec: unsupported frame version")
+	ErrHeaderTooLarge = errors.New("codec: frame header too large")
+	ErrBodyTooLarge   = errors.New("codec: frame body too large")
+)
+
+// DecodeError a frame was read completely but its header or body could not be
+// decoded. The stream is still in sync, only this message is lost.
+type DecodeError struct {
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return "codec: decode failed, " + e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+func IsDecodeError(err error) bool {
+	var de *DecodeError
+	return errors.As(err, &de)
+}
+
+// EncodeError the header or body of a message could not be encoded, nothing
+// was written and the connection is still usable
+type EncodeError struct {
+	Err error
+}
+
+func (e *EncodeError) Error() string {
+	return "codec: encode failed, " + e.Err.Error()
+}
+
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
+func IsEncodeError(err error) bool {
+	var ee *EncodeError
+	return errors.As(err, &ee)
+}
+
+// the upper 4 bits of the frame flags hold the MessageType
+const typeShift = 4
+
+// FrameHeader fixed size prefix of every frame
+type FrameHeader struct {
+	Version   uint8
+	Flags     uint8
+	HeaderLen uint32
+	BodyLen   uint32
+	Seq       uint64
+}
+
+func (h *FrameHeader) Marshal(b []byte) {
+	binary.BigEndian.PutUint16(b[0:2], FrameMagic)
+	b[2] = h.Version
+	b[3] = h.Flags
+	binary.BigEndian.PutUint32(b[4:8], h.HeaderLen)
+	binary.BigEndian.PutUint32(b[8:12], h.BodyLen)
+	binary.BigEndian.PutUint64(b[12:20], h.Seq)
+}
+
+func (h *FrameHeader) Unmarshal(b []byte) error {
+	if binary.BigEndian.Uint16(b[0:2]) != FrameMagic {
+		return ErrBadMagic
+	}
+	h.Version = b[2]
+	if h.Version != FrameVersion {
+		return ErrBadVersion
+	}
+	h.Flags = b[3]
+	h.HeaderLen = binary.BigEndian.Uint32(b[4:8])
+	h.BodyLen = binary.BigEndian.Uint32(b[8:12])
+	h.Seq = binary.BigEndian.Uint64(b[12:20])
+	if h.HeaderLen > MaxHeaderSize {
+		return ErrHeaderTooLarge
+	}
+	return nil
+}
+
+// Size total length of the frame on the wire
+func (h *FrameHeader) Size() int {
+	return FrameHeaderSize + int(h.HeaderLen) + int(h.BodyLen)
+}
+
+// Frame a whole message with header and body still encoded
+type Frame struct {
+	FrameHeader
+	Header []byte
+	Body   []byte
+}
+
+func ReadFrame(r io.Reader) (*Frame, error) {
+	var prefix [FrameHeaderSize]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+	f := new(Frame)
+	if err := f.FrameHeader.Unmarshal(prefix[:]); err != nil {
+		return nil, err
+	}
+	f.Header = make([]byte, f.HeaderLen)
+	if _, err := io.ReadFull(r, f.Header); err != nil {
+		return nil, err
+	}
+	if f.BodyLen > MaxBodySize {
+		// skip the body but keep the stream usable
+		if _, err := io.CopyN(ioutil.Discard, r, int64(f.BodyLen)); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+	f.Body = make([]byte, f.BodyLen)
+	if _, err := io.ReadFull(r, f.Body); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func WriteFrame(w io.Writer, f *Frame) error {
+	var prefix [FrameHeaderSize]byte
+	f.HeaderLen = uint32(len(f.Header))
+	f.BodyLen = uint32(len(f.Body))
+	f.FrameHeader.Marshal(prefix[:])
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(f.Header); err != nil {
+		return err
+	}
+	_, err := w.Write(f.Body)
+	return err
+}
+
+// Serializer encodes a single body on its own, one body per frame
+type Serializer interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// FrameCodec implements Codec on top of frames, bodies are encoded by a Serializer
+type FrameCodec struct {
+	conn  io.ReadWriteCloser
+	r     *bufio.Reader
+	w     *bufio.Writer
+	s     Serializer
+	frame *Frame // frame of the last header read
+
+	comp      Compressor // nil means bodies are never compressed
+	threshold int        // only bodies larger than threshold are compressed
+}
+
+func NewFrameCodec(conn io.ReadWriteCloser, s Serializer) *FrameCodec {
+	return &FrameCodec{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		w:    bufio.NewWriter(conn),
+		s:    s,
+	}
+}
+
+// SetCompressor compresses written bodies larger than threshold bytes.
+// Compressed frames are always accepted on read, whatever is set here.
+func (c *FrameCodec) SetCompressor(comp Compressor, threshold int) {
+	c.comp = comp
+	c.threshold = threshold
+}
+
+func (c *FrameCodec) Close() error {
+	return c.conn.Close()
+}
+
+// ReadHeader reads a whole frame, a header that fails to decode still reports
+// the frame seq so the caller can answer it.
+func (c *FrameCodec) ReadHeader(header *Header) error {
+	f, err := ReadFrame(c.r)
+	if err != nil {
+		return err
+	}
+	c.frame = f
+	return f.DecodeHeader(header)
+}
+
+// DecodeHeader decodes the header of f, seq and type come from the frame prefix
+// so they are set even if the header fails to decode
+func (f *Frame) DecodeHeader(header *Header) error {
+	header.Seq = f.Seq
+	header.Type = MessageType(f.Flags >> typeShift)
+	if err := json.Unmarshal(f.Header, header); err != nil {
+		return &DecodeError{Err: err}
+	}
+	return nil
+}
+
+// ReadBody decodes the body of the last frame, a nil body discards it
+func (c *FrameCodec) ReadBody(body interface{}) error {
+	f := c.frame
+	if f == nil {
+		return errors.New("codec: read body before header")
+	}
+	c.frame = nil
+	if body == nil {
+		return nil
+	}
+	if f.BodyLen > MaxBodySize {
+		return &DecodeError{Err: ErrBodyTooLarge}
+	}
+	data := f.Body
+	if f.Flags&FlagCompressed != 0 {
+		if c.comp == nil {
+			return &DecodeError{Err: errors.New("codec: compressed body without compressor")}
+		}
+		var err error
+		if data, err = c.comp.Decompress(data); err != nil {
+			return &DecodeError{Err: err}
+		}
+	}
+	if err := c.s.Unmarshal(data, body); err != nil {
+		return &DecodeError{Err: err}
+	}
+	return nil
+}
+
+func (c *FrameCodec) Write(header *Header, body interface{}) error {
+	// encode everything first, a bad body must not leave half a frame on the wire
+	var b []byte
+	var err error
+	// a nil body, e.g. of an error response, is sent empty whatever the serializer
+	if body != nil {
+		if b, err = c.s.Marshal(body); err != nil {
+			logger.Error("encode body failed,err:%v", err)
+			return &EncodeError{Err: err}
+		}
+	}
+	h, err := json.Marshal(header)
+	if err != nil {
+		logger.Error("encode header failed,err:%v", err)
+		return &EncodeError{Err: err}
+	}
+	f := &Frame{
+		FrameHeader: FrameHeader{Version: FrameVersion, Seq: header.Seq, Flags: uint8(header.Type) << typeShift},
+		Header:      h,
+		Body:        b,
+	}
+	if c.comp != nil && len(b) > c.threshold {
+		// keep the plain body when compression doesn't pay off
+		if cb, err := c.comp.Compress(b); err == nil && len(cb) < len(b) {
+			f.Body = cb
+			f.Flags |= FlagCompressed
+		}
+	}
+	if err = WriteFrame(c.w, f); err == nil {
+		err = c.w.Flush()
+	}
+	if err != nil {
+		logger.Error("write frame failed,err:%v", err)
+		_ = c.Close()
+	}
+	return err
+}
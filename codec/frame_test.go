@@ -0,0 +1,103 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+)
+
+type bufConn struct {
+	bytes.Buffer
+}
+
+func (b *bufConn) Close() error {
+	return nil
+}
+
+type frameArgs struct {
+	Num1, Num2 int
+}
+
+func TestFrameCodec(t *testing.T) {
+	for _, name := range []string{GobType, JsonType, MsgpackType} {
+		conn := new(bufConn)
+		cc := NewCodecFuncMap[name](conn)
+
+		if err := cc.Write(&Header{ServiceMethod: "Foo.Sum", Seq: 1}, &frameArgs{1, 2}); err != nil {
+			t.Fatalf("%s: write failed: %v", name, err)
+		}
+		if err := cc.Write(&Header{ServiceMethod: "Foo.Sum", Seq: 2}, "bad body"); err != nil {
+			t.Fatalf("%s: write failed: %v", name, err)
+		}
+		if err := cc.Write(&Header{ServiceMethod: "Foo.Sum", Seq: 3}, &frameArgs{3, 4}); err != nil {
+			t.Fatalf("%s: write failed: %v", name, err)
+		}
+
+		var h Header
+		var args frameArgs
+		if err := cc.ReadHeader(&h); err != nil || h.Seq != 1 || h.ServiceMethod != "Foo.Sum" {
+			t.Fatalf("%s: read header failed: %v %+v", name, err, h)
+		}
+		if err := cc.ReadBody(&args); err != nil || args.Num1 != 1 || args.Num2 != 2 {
+			t.Fatalf("%s: read body failed: %v %+v", name, err, args)
+		}
+
+		// the bad body fails alone, the next frame is still readable
+		if err := cc.ReadHeader(&h); err != nil || h.Seq != 2 {
+			t.Fatalf("%s: read header failed: %v %+v", name, err, h)
+		}
+		if err := cc.ReadBody(&args); !IsDecodeError(err) {
+			t.Fatalf("%s: expect decode error, got %v", name, err)
+		}
+		if err := cc.ReadHeader(&h); err != nil || h.Seq != 3 {
+			t.Fatalf("%s: read header failed: %v %+v", name, err, h)
+		}
+		if err := cc.ReadBody(&args); err != nil || args.Num1 != 3 || args.Num2 != 4 {
+			t.Fatalf("%s: read body failed: %v %+v", name, err, args)
+		}
+	}
+}
+
+func TestFrameCodec_MessageType(t *testing.T) {
+	conn := new(bufConn)
+	cc := NewJsonCodec(conn)
+	_ = cc.Write(&Header{Seq: 7, Type: TypeCancel}, nil)
+
+	var h Header
+	if err := cc.ReadHeader(&h); err != nil || h.Seq != 7 || h.Type != TypeCancel {
+		t.Fatalf("read header failed: %v %+v", err, h)
+	}
+	if err := cc.ReadBody(nil); err != nil {
+		t.Fatalf("read body failed: %v", err)
+	}
+}
+
+func TestReadFrame_BodyTooLarge(t *testing.T) {
+	conn := new(bufConn)
+	cc := NewJsonCodec(conn)
+	_ = cc.Write(&Header{ServiceMethod: "Foo.Sum", Seq: 1}, make([]int, 64))
+	_ = cc.Write(&Header{ServiceMethod: "Foo.Sum", Seq: 2}, 1)
+
+	defer func(size uint32) { MaxBodySize = size }(MaxBodySize)
+	MaxBodySize = 16
+
+	var h Header
+	var reply int
+	if err := cc.ReadHeader(&h); err != nil || h.Seq != 1 {
+		t.Fatalf("read header failed: %v %+v", err, h)
+	}
+	if err := cc.ReadBody(&reply); !IsDecodeError(err) {
+		t.Fatalf("expect body too large, got %v", err)
+	}
+	if err := cc.ReadHeader(&h); err != nil || h.Seq != 2 {
+		t.Fatalf("read header failed: %v %+v", err, h)
+	}
+	if err := cc.ReadBody(&reply); err != nil || reply != 1 {
+		t.Fatalf("read body failed: %v %d", err, reply)
+	}
+}
+
+func TestReadFrame_BadMagic(t *testing.T) {
+	if _, err := ReadFrame(bytes.NewReader(make([]byte, FrameHeaderSize))); err != ErrBadMagic {
+		t.Fatalf("expect bad magic, got %v", err)
+	}
+}
@@ -1,57 +1,27 @@
 package codec
 
 import (
-	"bufio"
+	"bytes"
 	"encoding/gob"
 	"io"
-	"zrpc/logger"
 )
 
-// GobCodec codec implement by codec func
-type GobCodec struct {
-	conn   io.ReadWriteCloser
-	buf    *bufio.Writer
-	decode *gob.Decoder // gob decode API
-	encode *gob.Encoder // gob encode API
-}
-
-func (g *GobCodec) Close() error {
-	return g.conn.Close()
-}
-
-// ReadHeader decode header part
-func (g *GobCodec) ReadHeader(header *Header) error {
-	return g.decode.Decode(header)
-}
+// GobSerializer every body gets a fresh gob encoder, so each frame carries its
+// own type information and can be decoded without the rest of the stream
+type GobSerializer struct{}
 
-func (g *GobCodec) ReadBody(i interface{}) error {
-	return g.decode.Decode(i)
+func (GobSerializer) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
-func (g *GobCodec) Write(header *Header, body interface{}) error {
-	defer func() {
-		err := g.buf.Flush()
-		if err != nil {
-			_ = g.Close()
-		}
-	}()
-	if err := g.encode.Encode(header); err != nil {
-		logger.Error("gob encode header err:%v", err)
-		return err
-	}
-	if err := g.encode.Encode(body); err != nil {
-		logger.Error("gob encode body err:%v", err)
-		return err
-	}
-	return nil
+func (GobSerializer) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
 }
 
 func NewGobCodec(conn io.ReadWriteCloser) Codec {
-	buf := bufio.NewWriter(conn)
-	return &GobCodec{
-		conn:   conn,
-		buf:    buf,
-		decode: gob.NewDecoder(conn),
-		encode: gob.NewEncoder(conn),
-	}
+	return NewFrameCodec(conn, GobSerializer{})
 }
@@ -0,0 +1,34 @@
+package codec
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MsgpackSerializer structs are encoded as maps keyed by their json tags, so
+// non-Go consumers see the same field names as with JsonCodec
+type MsgpackSerializer struct{}
+
+func (MsgpackSerializer) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	enc.UseCompactFloats(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (MsgpackSerializer) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+func NewMsgpackCodec(conn io.ReadWriteCloser) Codec {
+	return NewFrameCodec(conn, MsgpackSerializer{})
+}
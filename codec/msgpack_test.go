@@ -0,0 +1,45 @@
+package codec
+
+import (
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type record struct {
+	ID    int64             `json:"id"`
+	Name  string            `json:"name,omitempty"`
+	Tags  []string          `json:"tags"`
+	Attrs map[string]string `json:"attrs"`
+	Skip  string            `json:"-"`
+}
+
+func TestMsgpackSerializer(t *testing.T) {
+	in := record{ID: 7, Tags: []string{"a", "b"}, Attrs: map[string]string{"k": "v"}, Skip: "x"}
+	data, err := MsgpackSerializer{}.Marshal(&in)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+
+	// other languages see the json field names
+	var m map[string]interface{}
+	if err = msgpack.Unmarshal(data, &m); err != nil {
+		t.Fatalf("unmarshal to map failed: %v", err)
+	}
+	if _, ok := m["id"]; !ok || len(m) != 3 {
+		t.Fatalf("unexpected keys: %v", m)
+	}
+
+	var out record
+	if err = (MsgpackSerializer{}).Unmarshal(data, &out); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if out.ID != 7 || len(out.Tags) != 2 || out.Attrs["k"] != "v" || out.Skip != "" {
+		t.Fatalf("unexpected record: %+v", out)
+	}
+
+	js, _ := JsonSerializer{}.Marshal(&in)
+	if len(data) >= len(js) {
+		t.Fatalf("msgpack %d bytes is not smaller than json %d bytes", len(data), len(js))
+	}
+}
@@ -1,26 +1,36 @@
 package codec
 
 import (
+	"crypto/tls"
 	"errors"
 	"time"
 )
 
 const (
 	ZRpcMagicNumber = 0x3bef5c
+	// DefaultRPCPath HTTP CONNECT到该路径后，连接切换为rpc协议
+	DefaultRPCPath = "/_zrpc_"
 )
 
 type Option struct {
-	MagicNumber    int
-	CodecType      string
-	ConnectTimeout time.Duration // 建立连接超时
-	HandleTimeout  time.Duration // 处理连接请求超时
+	MagicNumber       int
+	CodecType         string
+	ConnectTimeout    time.Duration // 建立连接超时
+	HandleTimeout     time.Duration // 处理连接请求超时
+	Compression       string        // 消息体压缩算法 gzip/snappy/zstd，为空不压缩
+	CompressThreshold int           // 消息体超过该字节数才压缩，为0时使用DefaultOpt的阈值
+	Credential        string        // 握手时发送的凭证，如auth.BearerToken(token)，服务端配置了鉴权时校验
+
+	// TLSConfig XDial连接tls@addr时使用，带上客户端证书即为双向认证；不发送给服务端
+	TLSConfig *tls.Config `json:"-"`
 }
 
 var DefaultOpt = &Option{
-	MagicNumber:    ZRpcMagicNumber,
-	CodecType:      GobType,
-	ConnectTimeout: time.Second * 10,
-	HandleTimeout:  time.Second * 5,
+	MagicNumber:       ZRpcMagicNumber,
+	CodecType:         GobType,
+	ConnectTimeout:    time.Second * 10,
+	HandleTimeout:     time.Second * 5,
+	CompressThreshold: 1024,
 }
 
 func ParseOptions(opts ...*Option) (*Option, error) {
@@ -31,11 +41,16 @@ func ParseOptions(opts ...*Option) (*Option, error) {
 		return nil, errors.New("more than one options")
 	}
 
-	opt := opts[0]
+	// 复制一份，同一个opt可能被并发用于多次Dial
+	o := *opts[0]
+	opt := &o
 
 	opt.MagicNumber = ZRpcMagicNumber
 	if opt.CodecType == "" {
 		opt.CodecType = DefaultOpt.CodecType
 	}
+	if opt.CompressThreshold == 0 {
+		opt.CompressThreshold = DefaultOpt.CompressThreshold
+	}
 	return opt, nil
 }
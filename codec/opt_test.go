@@ -0,0 +1,17 @@
+package codec
+
+import "testing"
+
+func TestParseOptions(t *testing.T) {
+	opt, err := ParseOptions(&Option{Compression: CompressGzip})
+	if err != nil {
+		t.Fatalf("parse options failed: %v", err)
+	}
+	if opt.CompressThreshold != DefaultOpt.CompressThreshold || opt.CodecType != DefaultOpt.CodecType {
+		t.Fatalf("expect defaults, got %+v", opt)
+	}
+	opt, _ = ParseOptions(&Option{Compression: CompressGzip, CompressThreshold: 64})
+	if opt.CompressThreshold != 64 {
+		t.Fatalf("expect threshold 64, got %d", opt.CompressThreshold)
+	}
+}
@@ -0,0 +1,31 @@
+package codec
+
+import (
+	"fmt"
+	"io"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ProtoSerializer args and replies must implement proto.Message
+type ProtoSerializer struct{}
+
+func (ProtoSerializer) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("codec: %T is not a proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+func (ProtoSerializer) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("codec: %T is not a proto.Message", v)
+	}
+	return proto.Unmarshal(data, m)
+}
+
+func NewProtoCodec(conn io.ReadWriteCloser) Codec {
+	return NewFrameCodec(conn, ProtoSerializer{})
+}
@@ -0,0 +1,45 @@
+package codec
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestProtoCodec(t *testing.T) {
+	cc := NewProtoCodec(new(bufConn))
+
+	if err := cc.Write(&Header{ServiceMethod: "Foo.Echo", Seq: 1}, &frameArgs{1, 2}); err == nil {
+		t.Fatal("expect error writing a non proto body")
+	}
+	for seq := uint64(2); seq <= 3; seq++ {
+		if err := cc.Write(&Header{ServiceMethod: "Foo.Echo", Seq: seq}, wrapperspb.String("hello")); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	if err := cc.Write(&Header{ServiceMethod: "Foo.Echo", Seq: 4, Error: "failed"}, nil); err != nil {
+		t.Fatalf("write nil body failed: %v", err)
+	}
+
+	var h Header
+	var args frameArgs
+	reply := new(wrapperspb.StringValue)
+	if err := cc.ReadHeader(&h); err != nil || h.Seq != 2 {
+		t.Fatalf("read header failed: %v %+v", err, h)
+	}
+	if err := cc.ReadBody(reply); err != nil || reply.GetValue() != "hello" {
+		t.Fatalf("read body failed: %v %v", err, reply)
+	}
+	if err := cc.ReadHeader(&h); err != nil || h.Seq != 3 {
+		t.Fatalf("read header failed: %v %+v", err, h)
+	}
+	if err := cc.ReadBody(&args); !IsDecodeError(err) {
+		t.Fatalf("expect decode error for a non proto reply, got %v", err)
+	}
+	if err := cc.ReadHeader(&h); err != nil || h.Seq != 4 || h.Error != "failed" {
+		t.Fatalf("read header failed: %v %+v", err, h)
+	}
+	if err := cc.ReadBody(nil); err != nil {
+		t.Fatalf("discard body failed: %v", err)
+	}
+}
@@ -14,4 +14,11 @@ var (
 	RpcClientCallServiceTimeOut = errors.New("rpc client call service.method timeout")
 
 	ServerHandleRequestTimeOut = errors.New("server handle request timeout")
+
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+
+	ErrUnauthenticated  = errors.New("unauthenticated")
+	ErrPermissionDenied = errors.New("permission denied")
+
+	ErrServerOverloaded = errors.New("server overloaded")
 )
@@ -4,5 +4,9 @@ go 1.14
 
 require (
 	github.com/gin-gonic/gin v1.7.1
+	github.com/klauspost/compress v1.13.6
 	github.com/panjf2000/gnet v1.4.4
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	google.golang.org/protobuf v1.28.1
+	gopkg.in/yaml.v2 v2.2.8
 )
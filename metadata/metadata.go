@@ -0,0 +1,105 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// MD request scoped key/values (auth token, tenant, trace id...) carried by
+// codec.Header, so they don't have to be part of every args struct
+type MD map[string]string
+
+// Pairs builds MD from key, value, key, value...; a trailing key without value is dropped
+func Pairs(kv ...string) MD {
+	md := make(MD, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		md[kv[i]] = kv[i+1]
+	}
+	return md
+}
+
+func (md MD) Get(key string) string {
+	return md[key]
+}
+
+func (md MD) Set(key, value string) {
+	md[key] = value
+}
+
+func (md MD) Copy() MD {
+	out := make(MD, len(md))
+	for k, v := range md {
+		out[k] = v
+	}
+	return out
+}
+
+// Join later values win
+func Join(mds ...MD) MD {
+	out := MD{}
+	for _, md := range mds {
+		for k, v := range md {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+type (
+	outgoingKey struct{}
+	incomingKey struct{}
+	trailerKey  struct{}
+)
+
+// NewOutgoingContext md is sent along with every call made with ctx
+func NewOutgoingContext(ctx context.Context, md MD) context.Context {
+	return context.WithValue(ctx, outgoingKey{}, md)
+}
+
+// AppendToOutgoingContext adds key/value pairs to the outgoing md of ctx
+func AppendToOutgoingContext(ctx context.Context, kv ...string) context.Context {
+	md, _ := FromOutgoingContext(ctx)
+	return NewOutgoingContext(ctx, Join(md, Pairs(kv...)))
+}
+
+func FromOutgoingContext(ctx context.Context) (MD, bool) {
+	md, ok := ctx.Value(outgoingKey{}).(MD)
+	return md, ok
+}
+
+// NewIncomingContext used by the server to hand the request md to service methods
+func NewIncomingContext(ctx context.Context, md MD) context.Context {
+	return context.WithValue(ctx, incomingKey{}, md)
+}
+
+func FromIncomingContext(ctx context.Context) (MD, bool) {
+	md, ok := ctx.Value(incomingKey{}).(MD)
+	return md, ok
+}
+
+type trailer struct {
+	mu sync.Mutex
+	md *MD
+}
+
+var ErrNoTrailer = errors.New("metadata: context does not accept trailers")
+
+// WithTrailer trailers set on the returned context are merged into md.
+// The server uses it to collect response trailers, callers use it to receive them.
+func WithTrailer(ctx context.Context, md *MD) context.Context {
+	return context.WithValue(ctx, trailerKey{}, &trailer{md: md})
+}
+
+// SetTrailer merges md into the trailer of ctx, service methods use it to
+// send key/values back with the response
+func SetTrailer(ctx context.Context, md MD) error {
+	t, ok := ctx.Value(trailerKey{}).(*trailer)
+	if !ok {
+		return ErrNoTrailer
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	*t.md = Join(*t.md, md)
+	return nil
+}
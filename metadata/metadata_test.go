@@ -0,0 +1,31 @@
+package metadata
+
+import (
+	"context"
+	"testing"
+)
+
+func TestOutgoingContext(t *testing.T) {
+	ctx := NewOutgoingContext(context.Background(), Pairs("token", "abc", "dangling"))
+	ctx = AppendToOutgoingContext(ctx, "tenant", "t1", "token", "xyz")
+	md, ok := FromOutgoingContext(ctx)
+	if !ok || len(md) != 2 || md.Get("token") != "xyz" || md.Get("tenant") != "t1" {
+		t.Fatalf("unexpected outgoing md: %v", md)
+	}
+	if _, ok = FromIncomingContext(ctx); ok {
+		t.Fatal("outgoing md must not be seen as incoming")
+	}
+}
+
+func TestSetTrailer(t *testing.T) {
+	if err := SetTrailer(context.Background(), Pairs("k", "v")); err != ErrNoTrailer {
+		t.Fatalf("expect ErrNoTrailer, got %v", err)
+	}
+	var trailer MD
+	ctx := WithTrailer(context.Background(), &trailer)
+	_ = SetTrailer(ctx, Pairs("a", "1"))
+	_ = SetTrailer(ctx, Pairs("b", "2", "a", "3"))
+	if len(trailer) != 2 || trailer.Get("a") != "3" || trailer.Get("b") != "2" {
+		t.Fatalf("unexpected trailer: %v", trailer)
+	}
+}
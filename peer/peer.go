@@ -0,0 +1,50 @@
+package peer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509/pkix"
+	"net"
+)
+
+// Peer the remote side of the connection a request arrived on
+type Peer struct {
+	Addr net.Addr
+	// AuthInfo how the connection was authenticated, nil for plain connections
+	AuthInfo AuthInfo
+}
+
+// AuthInfo transport security of a connection, e.g. TLSInfo
+type AuthInfo interface {
+	AuthType() string
+}
+
+// TLSInfo the state of a TLS connection after the handshake
+type TLSInfo struct {
+	State tls.ConnectionState
+}
+
+func (TLSInfo) AuthType() string {
+	return "tls"
+}
+
+// Subject of the verified peer certificate; false when the peer sent no
+// certificate or it was not verified, i.e. the connection is not mutual TLS
+func (t TLSInfo) Subject() (pkix.Name, bool) {
+	if len(t.State.VerifiedChains) == 0 || len(t.State.VerifiedChains[0]) == 0 {
+		return pkix.Name{}, false
+	}
+	return t.State.VerifiedChains[0][0].Subject, true
+}
+
+type peerKey struct{}
+
+func NewContext(ctx context.Context, p *Peer) context.Context {
+	return context.WithValue(ctx, peerKey{}, p)
+}
+
+// FromContext service methods use it to find out who is calling
+func FromContext(ctx context.Context) (*Peer, bool) {
+	p, ok := ctx.Value(peerKey{}).(*Peer)
+	return p, ok
+}
@@ -0,0 +1,127 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+	"zrpc/logger"
+)
+
+const (
+	DefaultPath = "/_zrpc_/registry"
+	// DefaultTimeout 超过该时间没有心跳的服务端被剔除
+	DefaultTimeout = 5 * time.Minute
+)
+
+// HTTPClient 发送心跳和拉取服务端列表用的http.Client，带超时，注册中心卡住时不会一直阻塞
+var HTTPClient = &http.Client{Timeout: 5 * time.Second}
+
+// ServerItem 一个服务端的心跳内容，Addr格式为protocol@addr
+type ServerItem struct {
+	Addr     string   `json:"addr"`
+	Weight   int      `json:"weight,omitempty"`
+	Services []string `json:"services,omitempty"`
+
+	start time.Time // 最近一次心跳
+}
+
+// Registry 简单的注册中心：服务端POST心跳，客户端GET存活的服务端列表。
+// 没有持久化，适合测试和小规模部署
+type Registry struct {
+	timeout time.Duration // 0表示永不过期
+	mu      sync.Mutex
+	servers map[string]*ServerItem
+}
+
+func New(timeout time.Duration) *Registry {
+	return &Registry{
+		timeout: timeout,
+		servers: make(map[string]*ServerItem),
+	}
+}
+
+var DefaultRegistry = New(DefaultTimeout)
+
+func (r *Registry) putServer(item ServerItem) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	item.start = time.Now()
+	r.servers[item.Addr] = &item
+}
+
+// aliveServers 按地址排序，service不为空时只返回提供该服务的
+func (r *Registry) aliveServers(service string) []ServerItem {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	alive := make([]ServerItem, 0, len(r.servers))
+	for addr, s := range r.servers {
+		if r.timeout > 0 && s.start.Add(r.timeout).Before(time.Now()) {
+			delete(r.servers, addr)
+			continue
+		}
+		if service == "" || contains(s.Services, service) {
+			alive = append(alive, *s)
+		}
+	}
+	sort.Slice(alive, func(i, j int) bool { return alive[i].Addr < alive[j].Addr })
+	return alive
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHTTP GET ?service=Name 返回存活的服务端列表，POST 一个ServerItem作为心跳
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(r.aliveServers(req.URL.Query().Get("service")))
+	case http.MethodPost:
+		var item ServerItem
+		if err := json.NewDecoder(req.Body).Decode(&item); err != nil || item.Addr == "" {
+			http.Error(w, "invalid heartbeat", http.StatusBadRequest)
+			return
+		}
+		r.putServer(item)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (r *Registry) HandleHTTP(registryPath string) {
+	http.Handle(registryPath, r)
+	logger.Info("rpc registry path:%s", registryPath)
+}
+
+func HandleHTTP() {
+	DefaultRegistry.HandleHTTP(DefaultPath)
+}
+
+// SendHeartbeat 向registryURL上报一次item
+func SendHeartbeat(registryURL string, item ServerItem) error {
+	body, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	resp, err := HTTPClient.Post(registryURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		logger.Error("rpc server heartbeat failed,err:%v", err)
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("rpc registry: unexpected status %s", resp.Status)
+		logger.Error("rpc server heartbeat failed,err:%v", err)
+	}
+	return err
+}
@@ -0,0 +1,51 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"zrpc/logger"
+)
+
+func init() {
+	logger.SetLevel(logger.LevelNone)
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+func getServers(url string) []ServerItem {
+	resp, err := http.Get(url)
+	_assert(err == nil && resp.StatusCode == http.StatusOK, "get servers failed: %v", err)
+	defer func() { _ = resp.Body.Close() }()
+	var servers []ServerItem
+	_assert(json.NewDecoder(resp.Body).Decode(&servers) == nil, "decode servers failed")
+	return servers
+}
+
+func TestRegistry(t *testing.T) {
+	ts := httptest.NewServer(New(100 * time.Millisecond))
+	defer ts.Close()
+
+	_assert(SendHeartbeat(ts.URL, ServerItem{Addr: "tcp@a", Services: []string{"Foo"}}) == nil, "heartbeat a failed")
+	_assert(SendHeartbeat(ts.URL, ServerItem{Addr: "tcp@b", Weight: 2, Services: []string{"Bar"}}) == nil, "heartbeat b failed")
+	_assert(SendHeartbeat(ts.URL, ServerItem{}) != nil, "expect an empty address to be rejected")
+
+	servers := getServers(ts.URL)
+	_assert(len(servers) == 2 && servers[1].Addr == "tcp@b" && servers[1].Weight == 2, "unexpected servers %+v", servers)
+	servers = getServers(ts.URL + "?service=Foo")
+	_assert(len(servers) == 1 && servers[0].Addr == "tcp@a", "unexpected Foo servers %+v", servers)
+
+	// only the server that keeps beating survives the ttl
+	time.Sleep(60 * time.Millisecond)
+	_ = SendHeartbeat(ts.URL, ServerItem{Addr: "tcp@a", Services: []string{"Foo"}})
+	time.Sleep(60 * time.Millisecond)
+	servers = getServers(ts.URL)
+	_assert(len(servers) == 1 && servers[0].Addr == "tcp@a", "unexpected servers after expiry %+v", servers)
+}
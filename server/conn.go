@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"zrpc/auth"
+	"zrpc/codec"
+	"zrpc/logger"
+)
+
+// serverConn 一个连接上所有请求共享的状态，ServeConn和ServeGnet共用
+type serverConn struct {
+	ctx     context.Context // 连接级别的context，连接断开时取消，请求的context都由它派生
+	cancel  context.CancelFunc
+	cc      codec.Codec
+	opt     *codec.Option
+	sending sync.Mutex     // make sure to send a complete response
+	wg      sync.WaitGroup // wait until all request are handled
+
+	mu       sync.Mutex
+	inflight map[uint64]context.CancelFunc // 进行中的请求，收到取消消息时按seq取消
+
+	authOnce sync.Once // 握手时的凭证只校验一次
+	identity string
+	authErr  error
+}
+
+func newServerConn(ctx context.Context, cc codec.Codec, opt *codec.Option) *serverConn {
+	ctx, cancel := context.WithCancel(ctx)
+	return &serverConn{
+		ctx:      ctx,
+		cancel:   cancel,
+		cc:       cc,
+		opt:      opt,
+		inflight: make(map[uint64]context.CancelFunc),
+	}
+}
+
+// track 登记排队或执行中的请求，已有limit个时返回false，limit<=0不限制
+func (sc *serverConn) track(seq uint64, cancel context.CancelFunc, limit int) bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if limit > 0 && len(sc.inflight) >= limit {
+		return false
+	}
+	sc.inflight[seq] = cancel
+	return true
+}
+
+// untrack 请求结束，释放它的context
+func (sc *serverConn) untrack(seq uint64) {
+	sc.mu.Lock()
+	cancel := sc.inflight[seq]
+	delete(sc.inflight, seq)
+	sc.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// cancelCall 客户端已不再等待seq的结果
+func (sc *serverConn) cancelCall(seq uint64) {
+	sc.mu.Lock()
+	cancel := sc.inflight[seq]
+	sc.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// goAway 通知客户端不要再发送新的调用，已发出的调用仍会响应
+func (sc *serverConn) goAway() {
+	sc.sending.Lock()
+	defer sc.sending.Unlock()
+	if err := sc.cc.Write(&codec.Header{Type: codec.TypeGoAway}, nil); err != nil {
+		logger.Error("send go away failed,err:%v", err)
+	}
+}
+
+// idle 没有进行中的请求
+func (sc *serverConn) idle() bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return len(sc.inflight) == 0
+}
+
+// authenticate 校验握手时发送的Option.Credential，结果在连接上缓存
+func (sc *serverConn) authenticate(a auth.Authenticator) (string, error) {
+	sc.authOnce.Do(func() {
+		sc.identity, sc.authErr = auth.Authenticate(sc.ctx, a, sc.opt.Credential)
+	})
+	return sc.identity, sc.authErr
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"zrpc/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultDebugPath 列出已注册的服务和调用次数，DefaultDebugPath+"/json"返回同样内容的json
+const DefaultDebugPath = "/debug/zrpc"
+
+const debugText = `<html>
+	<head><title>zrpc services</title></head>
+	<body>
+	{{range .}}
+	<hr>
+	Service {{.Name}}
+	<hr>
+		<table>
+		<th align=center>Method</th><th align=center>Calls</th>
+		{{range .Methods}}
+			<tr>
+			<td align=left font=fixed>{{.Name}}({{.ArgType}}, {{.ReplyType}}) error</td>
+			<td align=center>{{.Calls}}</td>
+			</tr>
+		{{end}}
+		</table>
+	{{end}}
+	</body>
+	</html>`
+
+var debugTemplate = template.Must(template.New("zrpc debug").Parse(debugText))
+
+type debugMethod struct {
+	Name      string `json:"name"`
+	ArgType   string `json:"arg_type"`
+	ReplyType string `json:"reply_type"`
+	Calls     uint64 `json:"calls"`
+}
+
+type debugService struct {
+	Name    string        `json:"name"`
+	Methods []debugMethod `json:"methods"`
+}
+
+// debugServices 按服务名、方法名排序
+func (s *Server) debugServices() []debugService {
+	services := make([]debugService, 0)
+	s.serviceMap.Range(func(_, v interface{}) bool {
+		srv := v.(*service.Service)
+		ds := debugService{Name: srv.Name, Methods: make([]debugMethod, 0, len(srv.Method))}
+		for name, m := range srv.Method {
+			ds.Methods = append(ds.Methods, debugMethod{
+				Name:      name,
+				ArgType:   m.ArgType.String(),
+				ReplyType: m.ReplyType.String(),
+				Calls:     m.NumCalls(),
+			})
+		}
+		sort.Slice(ds.Methods, func(i, j int) bool { return ds.Methods[i].Name < ds.Methods[j].Name })
+		services = append(services, ds)
+		return true
+	})
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+	return services
+}
+
+func (s *Server) handleDebug(c *gin.Context) {
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := debugTemplate.Execute(c.Writer, s.debugServices()); err != nil {
+		_, _ = c.Writer.WriteString("rpc: error executing template: " + err.Error())
+	}
+}
+
+func (s *Server) handleDebugJSON(c *gin.Context) {
+	c.JSON(http.StatusOK, s.debugServices())
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"zrpc/codec"
+	"zrpc/logger"
+	"zrpc/peer"
+
+	"github.com/panjf2000/gnet"
+)
+
+// errShortMessage the buffered bytes do not hold a whole message yet
+var errShortMessage = errors.New("short message, wait for more data")
+
+// maxOptionSize 握手的option不会超过该长度，超过即关闭连接，未完成握手的连接不会无限缓存数据
+const maxOptionSize = 4 << 10
+
+func ServeGnet(addr string) error {
+	return DefaultServer.ServeGnet(addr)
+}
+
+// ServeGnet 基于gnet事件循环处理连接：握手、header/body解码都在event loop中完成，
+// 只有handleRequest会启动goroutine，空闲连接不再占用goroutine栈
+func (s *Server) ServeGnet(addr string) error {
+	s.mu.Lock()
+	if s.inShutdown {
+		s.mu.Unlock()
+		return nil
+	}
+	s.gnetAddrs[addr] = struct{}{}
+	s.mu.Unlock()
+	s.startHeartbeat()
+	logger.Info("rpc server serve gnet on:%v", addr)
+	return gnet.Serve(&gnetHandler{s: s}, "tcp://"+addr, gnet.WithMulticore(true))
+}
+
+type gnetHandler struct {
+	*gnet.EventServer
+	s *Server
+}
+
+func (h *gnetHandler) OnOpened(c gnet.Conn) (out []byte, action gnet.Action) {
+	if h.s.shuttingDown() {
+		return nil, gnet.Close
+	}
+	c.SetContext(&gnetConn{conn: c})
+	return
+}
+
+// OnClosed 连接断开，取消所有进行中请求的context
+func (h *gnetHandler) OnClosed(c gnet.Conn, err error) (action gnet.Action) {
+	if gc, ok := c.Context().(*gnetConn); ok && gc.sc != nil {
+		gc.sc.cancel()
+		h.s.trackConn(gc.sc, false)
+	}
+	return
+}
+
+func (h *gnetHandler) React(frame []byte, c gnet.Conn) (out []byte, action gnet.Action) {
+	gc := c.Context().(*gnetConn)
+	gc.pending = append(gc.pending, frame...)
+	consumed := false
+
+	// 1.opt
+	if gc.sc == nil {
+		n, err := splitJson(gc.pending)
+		if err == errShortMessage && len(gc.pending) > maxOptionSize || n > maxOptionSize {
+			logger.Error("conn option exceeds %d bytes", maxOptionSize)
+			return nil, gnet.Close
+		}
+		// json.Encoder terminates the option with a newline which must not
+		// be taken as the start of the first codec message
+		if err == errShortMessage || len(gc.pending) == n {
+			return
+		}
+		if err != nil {
+			logger.Error("decode conn option err:%v", err)
+			return nil, gnet.Close
+		}
+		var opt codec.Option
+		if err = json.Unmarshal(gc.pending[:n], &opt); err != nil {
+			logger.Error("decode conn option err:%v", err)
+			return nil, gnet.Close
+		}
+		cc, err := h.s.newCodec(gc, &opt)
+		if err != nil {
+			logger.Error("check conn option err:%v", err)
+			return nil, gnet.Close
+		}
+		if gc.pending[n] == '\n' {
+			n++
+		}
+		gc.pending = gc.pending[n:]
+		consumed = true
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: c.RemoteAddr()})
+		gc.sc = newServerConn(ctx, cc, &opt)
+		if !h.s.trackConn(gc.sc, true) {
+			return nil, gnet.Close
+		}
+	}
+
+	// 2.frames
+	for {
+		// the rest of an oversized body is dropped as it arrives
+		if gc.discard > 0 {
+			k := len(gc.pending)
+			if uint32(k) > gc.discard {
+				k = int(gc.discard)
+			}
+			gc.discard -= uint32(k)
+			gc.pending = gc.pending[k:]
+			consumed = true
+			if gc.discard > 0 {
+				break
+			}
+		}
+		fh, n, err := splitFrame(gc.pending)
+		if err == errShortMessage {
+			break
+		}
+		if err != nil {
+			logger.Error("split request failed,err:%v", err)
+			return nil, gnet.Close
+		}
+
+		var req *Request
+		if fh.BodyLen > codec.MaxBodySize {
+			// answer this request only, like codec.ReadFrame does for ServeConn
+			req, err = h.s.readOversized(&codec.Frame{FrameHeader: fh, Header: gc.pending[codec.FrameHeaderSize:n]})
+			gc.discard = fh.BodyLen
+		} else {
+			gc.ready.Write(gc.pending[:n])
+			req, err = h.s.readRequest(gc.sc.cc)
+		}
+		gc.pending = gc.pending[n:]
+		consumed = true
+		if !h.s.serveRequest(gc.sc, req, err) {
+			return nil, gnet.Close
+		}
+	}
+	// drop the consumed prefix so pending doesn't keep growing; a frame still
+	// arriving is not copied again on every read
+	if consumed {
+		gc.pending = append([]byte(nil), gc.pending...)
+	}
+	return
+}
+
+// gnetConn 一个gnet连接的状态，同时作为codec的io.ReadWriteCloser：
+// 读取event loop已切分好的完整消息，写入通过AsyncWrite交给event loop
+type gnetConn struct {
+	conn    gnet.Conn
+	pending []byte       // 已收到但还不足一帧的数据
+	discard uint32       // 超过MaxBodySize的body还未收到的字节数，收到即丢弃
+	ready   bytes.Buffer // 已切分好、等待codec读取的完整帧
+	sc      *serverConn  // 握手完成后创建
+}
+
+func (gc *gnetConn) Read(p []byte) (int, error) {
+	return gc.ready.Read(p)
+}
+
+// Write the codec may reuse p after Write returns, AsyncWrite does not copy it
+func (gc *gnetConn) Write(p []byte) (int, error) {
+	buf := make([]byte, len(p))
+	copy(buf, p)
+	if err := gc.conn.AsyncWrite(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (gc *gnetConn) Close() error {
+	return gc.conn.Close()
+}
+
+func splitJson(data []byte) (int, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return 0, errShortMessage
+		}
+		return 0, err
+	}
+	return int(dec.InputOffset()), nil
+}
+
+// splitFrame returns the length of the first whole frame in data. The body of
+// a frame over codec.MaxBodySize is not included, it is never buffered
+func splitFrame(data []byte) (codec.FrameHeader, int, error) {
+	var h codec.FrameHeader
+	if len(data) < codec.FrameHeaderSize {
+		return h, 0, errShortMessage
+	}
+	if err := h.Unmarshal(data); err != nil {
+		return h, 0, err
+	}
+	n := h.Size()
+	if h.BodyLen > codec.MaxBodySize {
+		n = codec.FrameHeaderSize + int(h.HeaderLen)
+	}
+	if len(data) >= n {
+		return h, n, nil
+	}
+	return h, 0, errShortMessage
+}
+
+// readOversized 与readRequest一致地处理body超过MaxBodySize的一帧：
+// 能解析出header的请求单独响应DecodeError，连接继续可用
+func (s *Server) readOversized(f *codec.Frame) (*Request, error) {
+	header := new(codec.Header)
+	req := &Request{Header: header}
+	if err := f.DecodeHeader(header); err != nil {
+		logger.Error("decode request header failed,err:%v", err)
+		return req, err
+	}
+	if header.Type == codec.TypeCancel {
+		return req, nil
+	}
+	if _, _, err := s.selectService(header.ServiceMethod); err != nil {
+		return req, err
+	}
+	err := &codec.DecodeError{Err: codec.ErrBodyTooLarge}
+	logger.Error("read request body failed,err :%v", err)
+	return req, err
+}
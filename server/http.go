@@ -0,0 +1,44 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"zrpc/codec"
+	"zrpc/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+const connected = "200 Connected to zrpc"
+
+// Engine 与rpc共用端口的gin engine，可以注册其他http接口
+func (s *Server) Engine() *gin.Engine {
+	return s.engine
+}
+
+// ServeHTTP Server可以直接交给http.Serve
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.engine.ServeHTTP(w, req)
+}
+
+// handleConnect 接管CONNECT请求的连接，之后按rpc协议处理
+func (s *Server) handleConnect(c *gin.Context) {
+	conn, rw, err := c.Writer.Hijack()
+	if err != nil {
+		logger.Error("rpc hijacking %v failed,err:%v", c.Request.RemoteAddr, err)
+		return
+	}
+	if _, err = io.WriteString(conn, "HTTP/1.0 "+connected+"\r\n\r\n"); err != nil {
+		logger.Error("write connect response failed,err:%v", err)
+		_ = conn.Close()
+		return
+	}
+	// http server可能已经缓冲了客户端随后发送的数据
+	s.ServeConn(&handshakeConn{Conn: conn, r: rw.Reader})
+}
+
+func (s *Server) handleHTTP() {
+	s.engine.Handle(http.MethodConnect, codec.DefaultRPCPath, s.handleConnect)
+	s.engine.GET(DefaultDebugPath, s.handleDebug)
+	s.engine.GET(DefaultDebugPath+"/json", s.handleDebugJSON)
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"zrpc/service"
+)
+
+// Handler 处理一个请求，返回的error作为响应的错误发给客户端
+type Handler func(ctx context.Context, req *Request) error
+
+// Interceptor 包裹请求的处理，调用next继续，不调用则直接以返回的error响应，
+// 可用于鉴权、日志、监控、参数校验等
+type Interceptor func(ctx context.Context, req *Request, next Handler) error
+
+// Use 追加拦截器，先追加的在外层；需要在开始服务前调用
+func (s *Server) Use(interceptors ...Interceptor) {
+	s.interceptors = append(s.interceptors, interceptors...)
+	s.handler = chainInterceptors(s.interceptors, s.call)
+}
+
+// call 最内层的Handler：调用service的方法，CrashOnPanic时把recover的panic重新抛出
+func (s *Server) call(ctx context.Context, req *Request) error {
+	err := req.Srv.Call(ctx, req.MType, req.argv, req.replyv)
+	var pe *service.PanicError
+	if s.panicMode == CrashOnPanic && errors.As(err, &pe) {
+		panic(fmt.Sprintf("%v\n\n%s", pe, pe.Stack))
+	}
+	return err
+}
+
+func chainInterceptors(interceptors []Interceptor, h Handler) Handler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		ic, next := interceptors[i], h
+		h = func(ctx context.Context, req *Request) error {
+			return ic(ctx, req, next)
+		}
+	}
+	return h
+}
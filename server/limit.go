@@ -0,0 +1,89 @@
+package server
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Limits 限制服务端同时处理的请求，0表示不限制；超出的请求以zrpc.ErrServerOverloaded响应
+type Limits struct {
+	MaxConcurrent        int // 整个服务端同时执行的请求数
+	MaxQueue             int // 达到MaxConcurrent后最多排队等待的请求数
+	MaxConcurrentPerConn int // 每个连接执行和排队中的请求数之和
+}
+
+func WithLimits(l Limits) ServerOption {
+	return func(s *Server) {
+		s.limits = l
+	}
+}
+
+// Stats 请求处理的统计
+type Stats struct {
+	Running  int    `json:"running"`  // 执行中的请求，包括已响应超时但方法还未返回的
+	Queued   int    `json:"queued"`   // 排队等待worker的请求
+	Rejected uint64 `json:"rejected"` // 因过载被拒绝的请求总数
+}
+
+func (s *Server) Stats() Stats {
+	return s.workers.stats()
+}
+
+// workerPool 最多max个worker执行请求，worker按需创建，队列空了就退出；
+// 所有worker都在忙时请求进入有界队列，队列满了拒绝
+type workerPool struct {
+	max      int // <=0不限制
+	maxQueue int
+
+	mu       sync.Mutex
+	running  int
+	queue    []func()
+	rejected uint64 // atomic
+}
+
+func newWorkerPool(max, maxQueue int) *workerPool {
+	return &workerPool{max: max, maxQueue: maxQueue}
+}
+
+// submit 不会阻塞，可以在gnet的事件循环中调用；返回false时task被拒绝
+func (p *workerPool) submit(task func()) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case p.max <= 0 || p.running < p.max:
+		p.running++
+		go p.work(task)
+	case len(p.queue) < p.maxQueue:
+		p.queue = append(p.queue, task)
+	default:
+		p.reject()
+		return false
+	}
+	return true
+}
+
+func (p *workerPool) work(task func()) {
+	for task != nil {
+		task()
+		p.mu.Lock()
+		task = nil
+		if len(p.queue) > 0 {
+			task = p.queue[0]
+			p.queue[0] = nil
+			p.queue = p.queue[1:]
+		} else {
+			p.running--
+		}
+		p.mu.Unlock()
+	}
+}
+
+func (p *workerPool) reject() {
+	atomic.AddUint64(&p.rejected, 1)
+}
+
+func (p *workerPool) stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return Stats{Running: p.running, Queued: len(p.queue), Rejected: atomic.LoadUint64(&p.rejected)}
+}
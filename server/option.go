@@ -0,0 +1,90 @@
+package server
+
+import (
+	"time"
+	"zrpc/auth"
+	"zrpc/registry"
+	"zrpc/service"
+)
+
+// ServerOption NewServer的可选配置
+type ServerOption func(*Server)
+
+// WithHeartbeat 开始服务后每interval向注册中心发送心跳，rpcAddr为客户端连接用的
+// protocol@addr；interval<=0时比注册中心的默认过期时间提前一分钟
+func WithHeartbeat(registryURL, rpcAddr string, interval time.Duration) ServerOption {
+	if interval <= 0 {
+		interval = registry.DefaultTimeout - time.Minute
+	}
+	return func(s *Server) {
+		s.registryURL = registryURL
+		s.rpcAddr = rpcAddr
+		s.heartbeatInterval = interval
+	}
+}
+
+// WithAuth 每个请求在调用方法前校验凭证并按p鉴权，p为nil时只要求通过认证；
+// 凭证取请求metadata中的auth.MetadataKey，没有时取握手时Option.Credential
+func WithAuth(a auth.Authenticator, p *auth.Policy) ServerOption {
+	return func(s *Server) {
+		s.authenticator = a
+		s.policy = p
+	}
+}
+
+// DefaultTLSHandshakeTimeout ServeTLS等待对端完成TLS握手的时间
+const DefaultTLSHandshakeTimeout = 10 * time.Second
+
+// WithTLSHandshakeTimeout 超过d没有完成TLS握手的连接被关闭
+func WithTLSHandshakeTimeout(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.tlsHandshakeTimeout = d
+	}
+}
+
+// PanicMode 方法panic时的处理方式
+type PanicMode int
+
+const (
+	RecoverOnPanic PanicMode = iota // 默认：只有这个请求以CodeInternal失败，服务继续运行
+	CrashOnPanic                    // 打印堆栈后重新panic，进程退出，便于调试
+)
+
+func WithPanicMode(mode PanicMode) ServerOption {
+	return func(s *Server) {
+		s.panicMode = mode
+	}
+}
+
+// startHeartbeat 只启动一次，Close后停止
+func (s *Server) startHeartbeat() {
+	if s.registryURL == "" {
+		return
+	}
+	// 在后台发送，注册中心不可用时也不影响开始服务
+	s.heartbeatOnce.Do(func() {
+		go func() {
+			_ = registry.SendHeartbeat(s.registryURL, s.heartbeatItem())
+			ticker := time.NewTicker(s.heartbeatInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-s.done:
+					return
+				case <-ticker.C:
+					_ = registry.SendHeartbeat(s.registryURL, s.heartbeatItem())
+				}
+			}
+		}()
+	})
+}
+
+// heartbeatItem 每次心跳都带上当前已注册的服务
+func (s *Server) heartbeatItem() registry.ServerItem {
+	item := registry.ServerItem{Addr: s.rpcAddr}
+	s.serviceMap.Range(func(_, v interface{}) bool {
+		item.Services = append(item.Services, v.(*service.Service).Name)
+		return true
+	})
+	return item
+}
@@ -15,3 +15,13 @@ type Request struct {
 	Srv   *service.Service
 	MType *service.MethodType
 }
+
+// Args 解码后的入参，拦截器可用于校验或记录
+func (r *Request) Args() interface{} {
+	return r.argv.Interface()
+}
+
+// Reply 方法写入的返回值，next返回后才有内容
+func (r *Request) Reply() interface{} {
+	return r.replyv.Interface()
+}
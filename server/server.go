@@ -1,7 +1,11 @@
 package server
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"io"
 	"net"
@@ -10,8 +14,11 @@ import (
 	"sync"
 	"time"
 	"zrpc"
+	"zrpc/auth"
 	"zrpc/codec"
 	"zrpc/logger"
+	"zrpc/metadata"
+	"zrpc/peer"
 	"zrpc/service"
 )
 
@@ -19,17 +26,56 @@ import (
 type Server struct {
 	engine     *gin.Engine
 	serviceMap sync.Map
+
+	interceptors []Interceptor
+	handler      Handler // interceptors包裹后的处理链
+
+	mu         sync.Mutex // 保护以下字段
+	listeners  map[net.Listener]struct{}
+	conns      map[*serverConn]struct{}
+	gnetAddrs  map[string]struct{}
+	inShutdown bool
+	done       chan struct{} // Shutdown或Close时关闭
+	doneOnce   sync.Once
+
+	registryURL       string
+	rpcAddr           string
+	heartbeatInterval time.Duration
+	heartbeatOnce     sync.Once
+
+	authenticator auth.Authenticator
+	policy        *auth.Policy
+	panicMode     PanicMode
+
+	tlsHandshakeTimeout time.Duration
+
+	limits  Limits
+	workers *workerPool
 }
 
-func NewServer() *Server {
-	return &Server{
-		engine: gin.Default(),
+func NewServer(opts ...ServerOption) *Server {
+	s := &Server{
+		engine:    gin.Default(),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[*serverConn]struct{}),
+		gnetAddrs: make(map[string]struct{}),
+		done:      make(chan struct{}),
+
+		tlsHandshakeTimeout: DefaultTLSHandshakeTimeout,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	s.workers = newWorkerPool(s.limits.MaxConcurrent, s.limits.MaxQueue)
+	s.handler = s.call
+	s.handleHTTP()
+	return s
 }
 
 func (s *Server) StartServer() {
 	//r := s.engine.Group("zrpc")
 
+	s.startHeartbeat()
 	s.engine.Run(":8009")
 }
 
@@ -47,6 +93,10 @@ func Accept(l net.Listener) {
 	DefaultServer.Accept(l)
 }
 
+func ServeTLS(l net.Listener, config *tls.Config) {
+	DefaultServer.ServeTLS(l, config)
+}
+
 func Register(srv interface{}) error {
 	return DefaultServer.RegisterService(srv)
 }
@@ -73,11 +123,19 @@ func (s *Server) selectService(serviceMethod string) (srv *service.Service, meth
 
 // l 监听句柄
 func (s *Server) Accept(l net.Listener) {
+	if !s.trackListener(l, true) {
+		_ = l.Close()
+		return
+	}
+	defer s.trackListener(l, false)
+	s.startHeartbeat()
 	// 阻塞建立连接
 	for {
 		conn, err := l.Accept()
 		if err != nil {
-			logger.Error("listener accept connection failed,err:%v", err)
+			if !s.shuttingDown() {
+				logger.Error("listener accept connection failed,err:%v", err)
+			}
 			return
 		}
 		logger.Info("rpc server detect conn, start serve conn...")
@@ -85,65 +143,172 @@ func (s *Server) Accept(l net.Listener) {
 	}
 }
 
-// TODO 接入ohio/gnet 对于网络服务端进行优化
+// ServeTLS 在l上接受TLS连接，config.ClientAuth要求客户端证书时即为双向认证，
+// 方法和拦截器通过peer.FromContext拿到对端证书
+func (s *Server) ServeTLS(l net.Listener, config *tls.Config) {
+	s.Accept(tls.NewListener(l, config))
+}
+
+// ServeConn 每个连接占用一个goroutine阻塞读取，海量空闲连接的场景可改用 ServeGnet
 func (s *Server) ServeConn(conn net.Conn) {
 	defer func() {
 		_ = conn.Close()
 	}()
+	p := &peer.Peer{Addr: conn.RemoteAddr()}
+	if tc, ok := conn.(*tls.Conn); ok {
+		// 握手完成后才能拿到对端证书；对端迟迟不握手时不一直占着goroutine
+		_ = tc.SetDeadline(time.Now().Add(s.tlsHandshakeTimeout))
+		if err := tc.Handshake(); err != nil {
+			logger.Error("tls handshake with %v failed,err:%v", conn.RemoteAddr(), err)
+			return
+		}
+		_ = tc.SetDeadline(time.Time{})
+		p.AuthInfo = peer.TLSInfo{State: tc.ConnectionState()}
+	}
 	var opt codec.Option
 	// 读conn数据
 	// 1.opt
-	if err := json.NewDecoder(conn).Decode(&opt); err != nil {
+	dec := json.NewDecoder(conn)
+	if err := dec.Decode(&opt); err != nil {
 		logger.Error("decode conn option err:%v", err)
 		return
 	}
-	// check opt
-	if opt.MagicNumber != codec.ZRpcMagicNumber {
-		logger.Error("not match magic number with zrpc")
-		return
+	// json decoder可能已经多读了请求数据，需要还给codec；同时丢弃opt末尾的换行符
+	r := bufio.NewReader(io.MultiReader(dec.Buffered(), conn))
+	if b, err := r.Peek(1); err == nil && b[0] == '\n' {
+		_, _ = r.Discard(1)
 	}
-	// get codec func by parse opt
-	codecFunc := codec.NewCodecFuncMap[opt.CodecType]
-	if codecFunc == nil {
-		logger.Error("not found specific codec type")
+	cc, err := s.newCodec(&handshakeConn{Conn: conn, r: r}, &opt)
+	if err != nil {
+		logger.Error("check conn option err:%v", err)
 		return
 	}
 	logger.Info("rpc server successfully parse option, start to codec request...")
-	s.serveCodec(codecFunc(conn), &opt)
+	ctx := peer.NewContext(context.Background(), p)
+	sc := newServerConn(ctx, cc, &opt)
+	if !s.trackConn(sc, true) {
+		return
+	}
+	defer s.trackConn(sc, false)
+	s.serveCodec(sc)
+}
+
+// authorize 配置了WithAuth时校验请求的凭证，通过后把身份放进ctx
+func (s *Server) authorize(ctx context.Context, sc *serverConn, req *Request) (context.Context, error) {
+	if s.authenticator == nil {
+		return ctx, nil
+	}
+	var identity string
+	var err error
+	if credential := req.Header.Metadata[auth.MetadataKey]; credential != "" {
+		identity, err = auth.Authenticate(auth.WithServiceMethod(ctx, req.Header.ServiceMethod), s.authenticator, credential)
+	} else {
+		identity, err = sc.authenticate(s.authenticator)
+	}
+	if err == nil {
+		err = s.policy.Authorize(identity, req.Header.ServiceMethod)
+	}
+	if err != nil {
+		logger.Error("rpc server reject %s,err:%v", req.Header.ServiceMethod, err)
+		return ctx, err
+	}
+	return auth.NewContext(ctx, identity), nil
+}
+
+// handshakeConn 先读取握手阶段缓冲的数据，再读取conn
+type handshakeConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *handshakeConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// newCodec 校验握手阶段的opt，按opt协商的编码和压缩方式创建codec
+func (s *Server) newCodec(conn io.ReadWriteCloser, opt *codec.Option) (codec.Codec, error) {
+	if opt.MagicNumber != codec.ZRpcMagicNumber {
+		return nil, errors.New("not match magic number with zrpc")
+	}
+	return codec.NewCodec(conn, opt)
 }
 
 // 一个连接存在多个请求(header+body)，需要等到全部请求处理后退出
-func (s *Server) serveCodec(cc codec.Codec, opt *codec.Option) {
-	sending := new(sync.Mutex) // make sure to send a complete response
-	wg := new(sync.WaitGroup)  // wait until all request are handled
+func (s *Server) serveCodec(sc *serverConn) {
 	for {
-		// todo 1 read-request
-		req, err := s.readRequest(cc)
-		if err != nil {
-			if req == nil {
-				break // it's not possible to recover, so close the connection
-			}
-			req.Header.Error = err.Error()
-			s.sendResponse(cc, req.Header, &InvalidRequest{}, sending)
-			continue
+		req, err := s.readRequest(sc.cc)
+		if !s.serveRequest(sc, req, err) {
+			break // it's not possible to recover, so close the connection
 		}
-		wg.Add(1)
-		go s.handleRequest(cc, req, sending, wg, opt)
 	}
-	wg.Wait()
-	_ = cc.Close()
+	// 连接已断开，没有人再等待响应
+	sc.cancel()
+	sc.wg.Wait()
+	_ = sc.cc.Close()
+}
+
+// serveRequest 处理readRequest读到的一帧，返回false时连接已不可用
+func (s *Server) serveRequest(sc *serverConn, req *Request, err error) bool {
+	if err != nil {
+		if req == nil {
+			return false
+		}
+		s.sendError(sc, req.Header, err)
+		return true
+	}
+	if req.Header.Type == codec.TypeCancel {
+		sc.cancelCall(req.Header.Seq)
+		return true
+	}
+	// 先登记再交给worker，紧随其后的取消消息也能找到这个请求；
+	// 超时从收到请求开始计算，排队的时间也算在内
+	ctx, cancel := requestContext(sc, req.Header)
+	if !sc.track(req.Header.Seq, cancel, s.limits.MaxConcurrentPerConn) {
+		cancel()
+		s.workers.reject()
+		s.sendError(sc, req.Header, zrpc.ErrServerOverloaded)
+		return true
+	}
+	sc.wg.Add(1)
+	if !s.workers.submit(func() { s.handleRequest(ctx, sc, req) }) {
+		sc.untrack(req.Header.Seq)
+		sc.wg.Done()
+		s.sendError(sc, req.Header, zrpc.ErrServerOverloaded)
+	}
+	return true
+}
+
+// requestContext 调用方剩余的等待时间和HandleTimeout取较小值
+func requestContext(sc *serverConn, header *codec.Header) (context.Context, context.CancelFunc) {
+	timeout := sc.opt.HandleTimeout
+	if header.Timeout > 0 && (timeout == 0 || header.Timeout < timeout) {
+		timeout = header.Timeout
+	}
+	if timeout > 0 {
+		return context.WithTimeout(sc.ctx, timeout)
+	}
+	return context.WithCancel(sc.ctx)
 }
 
 func (s *Server) readRequest(cc codec.Codec) (*Request, error) {
 	header, err := s.readRequestHeader(cc)
-	if err != nil {
-		logger.Error("read request header failed,err :%v", err)
+	if header == nil {
 		return nil, err
 	}
 	req := &Request{Header: header}
+	if err != nil {
+		// the frame is intact, skip its body and answer with the error
+		_ = cc.ReadBody(nil)
+		return req, err
+	}
+	if header.Type == codec.TypeCancel {
+		_ = cc.ReadBody(nil)
+		return req, nil
+	}
 
 	req.Srv, req.MType, err = s.selectService(req.Header.ServiceMethod)
 	if err != nil {
+		_ = cc.ReadBody(nil)
 		return req, err
 	}
 
@@ -160,18 +325,26 @@ func (s *Server) readRequest(cc codec.Codec) (*Request, error) {
 	err = s.readRequestBody(cc, argvi)
 	if err != nil {
 		logger.Error("read request body failed,err :%v", err)
+		// a body that fails to decode only rejects this request
+		if codec.IsDecodeError(err) {
+			return req, err
+		}
 		return nil, err
 	}
 	return req, err
 }
 
+// readRequestHeader header为nil时连接已不可用，否则只是当前这一帧有问题
 func (s *Server) readRequestHeader(cc codec.Codec) (*codec.Header, error) {
 	var header codec.Header
 	if err := cc.ReadHeader(&header); err != nil {
+		if codec.IsDecodeError(err) {
+			logger.Error("decode request header failed,err:%v", err)
+			return &header, err
+		}
 		if err != io.EOF && err != io.ErrUnexpectedEOF {
 			logger.Error("rpc server read header err:%v", err)
 		}
-		logger.Error("read request header failed,err:%v", err)
 		return nil, err
 	}
 	return &header, nil
@@ -185,50 +358,89 @@ func (s *Server) readRequestBody(cc codec.Codec, body interface{}) error {
 	return nil
 }
 
-type InvalidRequest struct{}
+// handleRequest 调用方法并发送响应。方法收到的ctx带有metadata、对端地址和
+// deadline，超时、客户端取消或连接断开时ctx被取消
+func (s *Server) handleRequest(ctx context.Context, sc *serverConn, req *Request) {
+	defer sc.wg.Done()
+	defer sc.untrack(req.Header.Seq)
 
-//todo 在此处实现RPC的函数调用过程
-func (s *Server) handleRequest(cc codec.Codec, req *Request, sending *sync.Mutex, wg *sync.WaitGroup, opt *codec.Option) {
-	defer wg.Done()
-
-	called := make(chan struct{}, 1)
-	sent := make(chan struct{}, 1)
+	// 请求的metadata交给方法读取，方法设置的trailer随响应返回
+	var trailer metadata.MD
+	ctx = metadata.NewIncomingContext(ctx, req.Header.Metadata)
+	ctx = metadata.WithTrailer(ctx, &trailer)
 
+	// 排队期间已超时或被取消的请求不再执行
+	if ctx.Err() != nil {
+		s.sendTimeout(sc, req.Header, ctx)
+		return
+	}
+	called := make(chan error, 1)
 	go func() {
-		err := req.Srv.Call(req.MType, req.argv, req.replyv)
-		called <- struct{}{}
+		ctx, err := s.authorize(ctx, sc, req)
 		if err != nil {
-			req.Header.Error = err.Error()
-			s.sendResponse(cc, req.Header, InvalidRequest{}, sending)
-			sent <- struct{}{}
+			called <- err
 			return
 		}
-		s.sendResponse(cc, req.Header, req.replyv.Interface(), sending)
-		sent <- struct{}{}
+		called <- s.handler(ctx, req)
 	}()
 
-	if opt.HandleTimeout == 0 {
-		called <- struct{}{}
-		sent <- struct{}{}
-		return
+	select {
+	case err := <-called:
+		// 被取消的请求即使方法已返回也不再响应
+		if ctx.Err() != nil {
+			s.sendTimeout(sc, req.Header, ctx)
+			return
+		}
+		if err != nil {
+			s.sendError(sc, req.Header, err)
+			return
+		}
+		req.Header.Metadata = trailer
+		s.sendResponse(sc, req.Header, req.replyv.Interface())
+	case <-ctx.Done():
+		// 先响应超时，但方法返回前仍占着worker和连接的名额，
+		// 否则不理会ctx的方法会让并发数超出Limits
+		s.sendTimeout(sc, req.Header, ctx)
+		<-called
 	}
+}
 
-	select {
-	case <-time.After(opt.HandleTimeout):
+// sendTimeout 超时时响应ServerHandleRequestTimeOut；客户端取消或连接断开时没有人等待响应
+func (s *Server) sendTimeout(sc *serverConn, header *codec.Header, ctx context.Context) {
+	if ctx.Err() == context.DeadlineExceeded {
 		logger.Error(zrpc.ServerHandleRequestTimeOut.Error())
-		s.sendResponse(cc, req.Header, &InvalidRequest{}, sending)
-		return
-	case <-called:
-		<-sent
+		s.sendError(sc, header, zrpc.ServerHandleRequestTimeOut)
 	}
+}
 
+// sendError 错误响应不带body，也不回传请求的metadata；错误按zrpc.Status带上状态码，
+// 请求body解码失败是调用方传错了参数，响应CodeInvalidArgument
+func (s *Server) sendError(sc *serverConn, header *codec.Header, err error) {
+	st := zrpc.StatusFromError(err)
+	if st.Code == zrpc.CodeUnknown && codec.IsDecodeError(err) {
+		st = zrpc.NewStatus(zrpc.CodeInvalidArgument, err.Error())
+	}
+	setStatus(header, st)
+	s.sendResponse(sc, header, nil)
 }
 
-// 需要加锁，不能并发
-func (s *Server) sendResponse(cc codec.Codec, header *codec.Header, body interface{}, lock *sync.Mutex) {
-	lock.Lock()
-	defer lock.Unlock()
-	if err := cc.Write(header, body); err != nil {
+func setStatus(header *codec.Header, st *zrpc.Status) {
+	header.Error = st.Message
+	header.Code = uint32(st.Code)
+	header.Details = st.Details
+	header.Metadata = nil
+}
+
+// 需要加锁，不能并发；返回值无法编码时改为响应CodeInternal的错误，调用方不会一直等待
+func (s *Server) sendResponse(sc *serverConn, header *codec.Header, body interface{}) {
+	sc.sending.Lock()
+	defer sc.sending.Unlock()
+	err := sc.cc.Write(header, body)
+	if body != nil && codec.IsEncodeError(err) {
+		setStatus(header, zrpc.NewStatus(zrpc.CodeInternal, err.Error()))
+		err = sc.cc.Write(header, nil)
+	}
+	if err != nil {
 		logger.Error("write response to client failed,err:%v", err)
 	}
 }
@@ -0,0 +1,802 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"zrpc"
+	"zrpc/auth"
+	"zrpc/client"
+	"zrpc/codec"
+	"zrpc/logger"
+	"zrpc/metadata"
+	"zrpc/peer"
+	"zrpc/registry"
+	"zrpc/service"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type Foo int
+
+type Args struct{ Num1, Num2 int }
+
+func (f Foo) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func (f Foo) Repeat(args Args, reply *[]int) error {
+	for i := 0; i < args.Num2; i++ {
+		*reply = append(*reply, args.Num1)
+	}
+	return nil
+}
+
+// Tenant echoes the tenant sent as metadata and reports who served it in the trailer
+func (f Foo) Tenant(ctx context.Context, args Args, reply *string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	*reply = md.Get("tenant")
+	return metadata.SetTrailer(ctx, metadata.Pairs("served-by", "foo"))
+}
+
+// Div fails with a status code chosen by the handler
+func (f Foo) Div(args Args, reply *int) error {
+	if args.Num2 == 0 {
+		return zrpc.NewStatus(zrpc.CodeInvalidArgument, "divide by zero", "num2")
+	}
+	if args.Num1 < 0 {
+		return errors.New("negative dividend")
+	}
+	*reply = args.Num1 / args.Num2
+	return nil
+}
+
+func (f Foo) Panic(args Args, reply *int) error {
+	panic("handler bug")
+}
+
+// Identity reports the caller identity established by WithAuth
+func (f Foo) Identity(ctx context.Context, args Args, reply *string) error {
+	*reply, _ = auth.FromContext(ctx)
+	return nil
+}
+
+// Peer reports the caller address seen by the server
+func (f Foo) Peer(ctx context.Context, args Args, reply *string) error {
+	if p, ok := peer.FromContext(ctx); ok {
+		*reply = p.Addr.String()
+	}
+	return nil
+}
+
+// busy counts Foo.Busy calls running at the same time, busyMax the highest count seen
+var busy, busyMax int32
+
+// Busy ignores ctx, like a handler stuck in a blocking call
+func (f Foo) Busy(args Args, reply *int) error {
+	n := atomic.AddInt32(&busy, 1)
+	defer atomic.AddInt32(&busy, -1)
+	for {
+		max := atomic.LoadInt32(&busyMax)
+		if n <= max || atomic.CompareAndSwapInt32(&busyMax, max, n) {
+			break
+		}
+	}
+	time.Sleep(time.Duration(args.Num1) * time.Millisecond)
+	return nil
+}
+
+// sleepErr receives the reason Foo.Sleep stopped waiting
+var sleepErr = make(chan error, 1)
+
+func (f Foo) Sleep(ctx context.Context, args Args, reply *int) error {
+	select {
+	case <-ctx.Done():
+		sleepErr <- ctx.Err()
+		return ctx.Err()
+	case <-time.After(time.Duration(args.Num1) * time.Millisecond):
+		sleepErr <- nil
+		return nil
+	}
+}
+
+// Echo serves protobuf clients
+type Echo int
+
+func (e Echo) Upper(args *wrapperspb.StringValue, reply *wrapperspb.StringValue) error {
+	reply.Value = strings.ToUpper(args.GetValue())
+	return nil
+}
+
+// Len takes a proto message but its reply is not one
+func (e Echo) Len(args *wrapperspb.StringValue, reply *int) error {
+	*reply = len(args.GetValue())
+	return nil
+}
+
+func init() {
+	gin.SetMode(gin.TestMode)
+	logger.SetLevel(logger.LevelNone)
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+func newTestServer() *Server {
+	s := NewServer()
+	_ = s.RegisterService(new(Foo))
+	_ = s.RegisterService(new(Echo))
+	return s
+}
+
+func startAccept(s *Server) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	go s.Accept(l)
+	return l.Addr().String()
+}
+
+func startGnet(s *Server) string {
+	// gnet does not report the port it bound, so reserve a free one first
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+	go func() { _ = s.ServeGnet(addr) }()
+	for i := 0; i < 50; i++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			_ = conn.Close()
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return addr
+}
+
+func testServe(t *testing.T, addr string) {
+	for _, codecType := range []string{codec.GobType, codec.JsonType, codec.MsgpackType} {
+		c, err := client.Dial("tcp", addr, &codec.Option{CodecType: codecType})
+		_assert(err == nil, "dial server failed: %v", err)
+
+		for i := 0; i < 10; i++ {
+			var reply int
+			err = c.SyncCall(context.Background(), "Foo.Sum", &Args{Num1: i, Num2: i * i}, &reply)
+			_assert(err == nil && reply == i+i*i, "%s: call Foo.Sum failed: %v, reply %d", codecType, err, reply)
+		}
+
+		var reply int
+		err = c.SyncCall(context.Background(), "Foo.Missing", &Args{}, &reply)
+		_assert(err != nil, "%s: expect not found method error", codecType)
+		// a body of the wrong type is rejected without closing the connection
+		err = c.SyncCall(context.Background(), "Foo.Sum", "not args", &reply)
+		_assert(err != nil, "%s: expect decode body error", codecType)
+		err = c.SyncCall(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+		_assert(err == nil && reply == 3, "%s: call after error failed: %v", codecType, err)
+		_ = c.Close()
+	}
+}
+
+func TestServer_Proto(t *testing.T) {
+	c, err := client.Dial("tcp", startAccept(newTestServer()), &codec.Option{CodecType: codec.ProtoType})
+	_assert(err == nil, "dial server failed: %v", err)
+	defer func() { _ = c.Close() }()
+
+	reply := new(wrapperspb.StringValue)
+	err = c.SyncCall(context.Background(), "Echo.Upper", wrapperspb.String("zrpc"), reply)
+	_assert(err == nil && reply.GetValue() == "ZRPC", "call Echo.Upper failed: %v, reply %v", err, reply)
+
+	// Foo.Sum does not take proto messages, the server reports it per call
+	var sum int
+	err = c.SyncCall(context.Background(), "Foo.Sum", wrapperspb.Int64(1), &sum)
+	_assert(zrpc.CodeOf(err) == zrpc.CodeInvalidArgument && strings.Contains(err.Error(), "not a proto.Message"), "expect proto error, got %v", err)
+	err = c.SyncCall(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &sum)
+	_assert(err != nil && strings.Contains(err.Error(), "not a proto.Message"), "expect proto error, got %v", err)
+
+	// a reply that can't be encoded is answered with an error instead of nothing
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	var n int
+	err = c.SyncCall(ctx, "Echo.Len", wrapperspb.String("zrpc"), &n)
+	_assert(zrpc.CodeOf(err) == zrpc.CodeInternal && strings.Contains(err.Error(), "not a proto.Message"), "expect encode error, got %v", err)
+}
+
+func TestServer_Compression(t *testing.T) {
+	addr := startAccept(newTestServer())
+	for name := range codec.CompressorMap {
+		c, err := client.Dial("tcp", addr, &codec.Option{Compression: name, CompressThreshold: 128})
+		_assert(err == nil, "%s: dial server failed: %v", name, err)
+
+		var reply []int
+		err = c.SyncCall(context.Background(), "Foo.Repeat", &Args{Num1: 7, Num2: 1000}, &reply)
+		_assert(err == nil && len(reply) == 1000 && reply[999] == 7, "%s: call Foo.Repeat failed: %v", name, err)
+		var sum int
+		err = c.SyncCall(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &sum)
+		_assert(err == nil && sum == 3, "%s: call Foo.Sum failed: %v", name, err)
+		_ = c.Close()
+	}
+}
+
+func TestServer_Metadata(t *testing.T) {
+	c, err := client.Dial("tcp", startAccept(newTestServer()))
+	_assert(err == nil, "dial server failed: %v", err)
+	defer func() { _ = c.Close() }()
+
+	var trailer metadata.MD
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("tenant", "t1"))
+	ctx = metadata.WithTrailer(ctx, &trailer)
+	var reply string
+	err = c.SyncCall(ctx, "Foo.Tenant", &Args{}, &reply)
+	_assert(err == nil && reply == "t1", "call Foo.Tenant failed: %v, reply %q", err, reply)
+	_assert(trailer.Get("served-by") == "foo", "unexpected trailer: %v", trailer)
+
+	// request metadata is not echoed back
+	trailer = nil
+	var sum int
+	err = c.SyncCall(ctx, "Foo.Sum", &Args{Num1: 1, Num2: 2}, &sum)
+	_assert(err == nil && sum == 3 && len(trailer) == 0, "unexpected trailer: %v", trailer)
+}
+
+func TestServer_Context(t *testing.T) {
+	addr := startAccept(newTestServer())
+	c, err := client.Dial("tcp", addr, &codec.Option{HandleTimeout: 100 * time.Millisecond})
+	_assert(err == nil, "dial server failed: %v", err)
+	defer func() { _ = c.Close() }()
+
+	var remote string
+	err = c.SyncCall(context.Background(), "Foo.Peer", &Args{}, &remote)
+	_assert(err == nil && strings.HasPrefix(remote, "127.0.0.1:"), "unexpected peer %q: %v", remote, err)
+
+	// HandleTimeout cancels the handler context and answers with a timeout
+	var reply int
+	err = c.SyncCall(context.Background(), "Foo.Sleep", &Args{Num1: 10000}, &reply)
+	_assert(errors.Is(err, zrpc.ServerHandleRequestTimeOut), "expect handle timeout, got %v", err)
+	_assert(zrpc.CodeOf(err) == zrpc.CodeDeadlineExceeded, "unexpected code %v", zrpc.CodeOf(err))
+	_assert(<-sleepErr == context.DeadlineExceeded, "handler context was not cancelled by HandleTimeout")
+
+	// the caller's deadline bounds the handler even below HandleTimeout
+	c3, _ := client.Dial("tcp", addr)
+	defer func() { _ = c3.Close() }()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = c3.SyncCall(ctx, "Foo.Sleep", &Args{Num1: 10000}, &reply)
+	_assert(err == zrpc.RpcClientCallServiceTimeOut, "expect client timeout, got %v", err)
+	// the client's cancel message may beat the server's own timer
+	err = <-sleepErr
+	_assert(err != nil && time.Since(start) < time.Second, "handler ignored the caller deadline: %v", err)
+
+	// closing the connection cancels in-flight handlers
+	c2, _ := client.Dial("tcp", addr, &codec.Option{})
+	c2.AsyncCall("Foo.Sleep", &Args{Num1: 10000}, &reply, nil)
+	time.Sleep(50 * time.Millisecond)
+	_ = c2.Close()
+	select {
+	case err = <-sleepErr:
+		_assert(err == context.Canceled, "expect canceled, got %v", err)
+	case <-time.After(time.Second):
+		_assert(false, "handler context was not cancelled when the client went away")
+	}
+}
+
+func TestServer_Cancel(t *testing.T) {
+	for _, addr := range []string{startAccept(newTestServer()), startGnet(newTestServer())} {
+		c, err := client.Dial("tcp", addr)
+		_assert(err == nil, "dial server failed: %v", err)
+
+		// cancelling the caller's context cancels the handler on the server
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+		var reply int
+		err = c.SyncCall(ctx, "Foo.Sleep", &Args{Num1: 10000}, &reply)
+		_assert(err == zrpc.RpcClientCallServiceTimeOut, "expect client timeout, got %v", err)
+		select {
+		case err = <-sleepErr:
+			_assert(err == context.Canceled, "expect canceled, got %v", err)
+		case <-time.After(time.Second):
+			_assert(false, "handler context was not cancelled by the client")
+		}
+
+		// the connection stays usable
+		err = c.SyncCall(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+		_assert(err == nil && reply == 3, "call after cancel failed: %v", err)
+		_ = c.Close()
+	}
+}
+
+func TestServer_Interceptor(t *testing.T) {
+	s := newTestServer()
+	var trace []string
+	s.Use(func(ctx context.Context, req *Request, next Handler) error {
+		err := next(ctx, req)
+		if sum, ok := req.Reply().(*int); ok {
+			trace = append(trace, fmt.Sprintf("%s=%d", req.Header.ServiceMethod, *sum))
+		}
+		return err
+	}, func(ctx context.Context, req *Request, next Handler) error {
+		// validation rejects the call before the method runs
+		if args, ok := req.Args().(Args); ok && args.Num1 < 0 {
+			return errors.New("negative args")
+		}
+		return next(ctx, req)
+	})
+	c, err := client.Dial("tcp", startAccept(s))
+	_assert(err == nil, "dial server failed: %v", err)
+	defer func() { _ = c.Close() }()
+	c.WithInterceptors(func(ctx context.Context, c *client.Client, serviceMethod string, args, reply interface{}, next client.Invoker) error {
+		ctx = metadata.AppendToOutgoingContext(ctx, "tenant", "t2")
+		return next(ctx, serviceMethod, args, reply)
+	})
+
+	var sum int
+	err = c.SyncCall(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &sum)
+	_assert(err == nil && sum == 3, "call Foo.Sum failed: %v", err)
+	err = c.SyncCall(context.Background(), "Foo.Sum", &Args{Num1: -1, Num2: 2}, &sum)
+	_assert(err != nil && err.Error() == "negative args", "expect validation error, got %v", err)
+	_assert(len(trace) == 2 && trace[0] == "Foo.Sum=3", "unexpected trace %v", trace)
+
+	var tenant string
+	err = c.SyncCall(context.Background(), "Foo.Tenant", &Args{}, &tenant)
+	_assert(err == nil && tenant == "t2", "client interceptor metadata lost: %v, %q", err, tenant)
+}
+
+func TestServer_Status(t *testing.T) {
+	c, err := client.Dial("tcp", startAccept(newTestServer()))
+	_assert(err == nil, "dial server failed: %v", err)
+	defer func() { _ = c.Close() }()
+	ctx := context.Background()
+	var reply int
+
+	// sentinel errors round-trip
+	err = c.SyncCall(ctx, "Bar.Sum", &Args{}, &reply)
+	_assert(errors.Is(err, zrpc.NotFoundService) && !errors.Is(err, zrpc.NotFoundMethod), "expect NotFoundService, got %v", err)
+	err = c.SyncCall(ctx, "Foo.Mul", &Args{}, &reply)
+	_assert(errors.Is(err, zrpc.NotFoundMethod) && zrpc.CodeOf(err) == zrpc.CodeNotFound, "expect NotFoundMethod, got %v", err)
+
+	// args that don't decode are the caller's fault
+	err = c.SyncCall(ctx, "Foo.Sum", "not args", &reply)
+	_assert(zrpc.CodeOf(err) == zrpc.CodeInvalidArgument, "expect CodeInvalidArgument, got %v", err)
+
+	// the handler chooses the code
+	err = c.SyncCall(ctx, "Foo.Div", &Args{Num1: 1}, &reply)
+	var st *zrpc.Status
+	_assert(errors.As(err, &st) && st.Code == zrpc.CodeInvalidArgument && st.Message == "divide by zero" &&
+		len(st.Details) == 1 && st.Details[0] == "num2", "unexpected status %#v", st)
+	_assert(errors.Is(err, &zrpc.Status{Code: zrpc.CodeInvalidArgument}), "expect to match by code")
+
+	// plain errors are CodeUnknown
+	err = c.SyncCall(ctx, "Foo.Div", &Args{Num1: -1, Num2: 1}, &reply)
+	_assert(zrpc.CodeOf(err) == zrpc.CodeUnknown && err.Error() == "negative dividend", "unexpected %v", err)
+}
+
+func TestServer_PanicRecovery(t *testing.T) {
+	c, err := client.Dial("tcp", startAccept(newTestServer()))
+	_assert(err == nil, "dial server failed: %v", err)
+	defer func() { _ = c.Close() }()
+	var reply int
+	err = c.SyncCall(context.Background(), "Foo.Panic", &Args{}, &reply)
+	_assert(zrpc.CodeOf(err) == zrpc.CodeInternal && strings.Contains(err.Error(), "handler bug"), "expect internal error, got %v", err)
+	// the connection and the server survive
+	err = c.SyncCall(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "call after panic failed: %v", err)
+
+	// CrashOnPanic panics again instead of answering
+	s := NewServer(WithPanicMode(CrashOnPanic))
+	srv := service.NewService(new(Foo))
+	req := &Request{Srv: srv, MType: srv.Method["Panic"]}
+	req.argv, req.replyv = req.MType.NewArgv(), req.MType.NewReplyv()
+	func() {
+		defer func() {
+			v := recover()
+			_assert(v != nil && strings.Contains(fmt.Sprint(v), "handler bug"), "expect panic, got %v", v)
+		}()
+		_ = s.call(context.Background(), req)
+	}()
+}
+
+func TestServer_Limits(t *testing.T) {
+	s := NewServer(WithLimits(Limits{MaxConcurrent: 1, MaxQueue: 1}))
+	_ = s.RegisterService(new(Foo))
+	addr := startAccept(s)
+	c, err := client.Dial("tcp", addr)
+	_assert(err == nil, "dial server failed: %v", err)
+	defer func() { _ = c.Close() }()
+
+	// one running, one queued, the third is shed
+	var r1, r2, r3 int
+	running := c.AsyncCall("Foo.Sleep", &Args{Num1: 100}, &r1, nil)
+	time.Sleep(20 * time.Millisecond)
+	queued := c.AsyncCall("Foo.Sleep", &Args{Num1: 1}, &r2, nil)
+	time.Sleep(20 * time.Millisecond)
+	stats := s.Stats()
+	_assert(stats.Running == 1 && stats.Queued == 1, "unexpected stats %+v", stats)
+	err = c.SyncCall(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &r3)
+	_assert(errors.Is(err, zrpc.ErrServerOverloaded) && zrpc.CodeOf(err) == zrpc.CodeResourceExhausted, "expect overloaded, got %v", err)
+	for _, call := range []*client.Call{running, queued} {
+		<-call.Done
+		_assert(call.Error == nil && <-sleepErr == nil, "admitted call failed: %v", call.Error)
+	}
+	stats = s.Stats()
+	_assert(stats.Running == 0 && stats.Queued == 0 && stats.Rejected == 1, "unexpected stats %+v", stats)
+
+	// handlers that outlive HandleTimeout keep their slot until they return
+	c3, err := client.Dial("tcp", addr, &codec.Option{HandleTimeout: 20 * time.Millisecond})
+	_assert(err == nil, "dial server failed: %v", err)
+	defer func() { _ = c3.Close() }()
+	calls := make([]*client.Call, 2)
+	for i := range calls {
+		calls[i] = c3.AsyncCall("Foo.Busy", &Args{Num1: 60}, &r1, nil)
+	}
+	time.Sleep(40 * time.Millisecond)
+	stats = s.Stats()
+	_assert(stats.Running == 1, "a timed out handler must still count as running: %+v", stats)
+	for _, call := range calls {
+		<-call.Done
+		_assert(errors.Is(call.Error, zrpc.ServerHandleRequestTimeOut), "expect handle timeout, got %v", call.Error)
+	}
+	time.Sleep(80 * time.Millisecond)
+	_assert(atomic.LoadInt32(&busyMax) == 1, "%d handlers ran at once with MaxConcurrent 1", busyMax)
+	stats = s.Stats()
+	_assert(stats.Running == 0 && stats.Queued == 0, "unexpected stats %+v", stats)
+
+	// the per connection limit leaves other connections alone
+	s = NewServer(WithLimits(Limits{MaxConcurrentPerConn: 1}))
+	_ = s.RegisterService(new(Foo))
+	addr = startAccept(s)
+	c1, err := client.Dial("tcp", addr)
+	_assert(err == nil, "dial server failed: %v", err)
+	defer func() { _ = c1.Close() }()
+	c2, err := client.Dial("tcp", addr)
+	_assert(err == nil, "dial server failed: %v", err)
+	defer func() { _ = c2.Close() }()
+	running = c1.AsyncCall("Foo.Sleep", &Args{Num1: 100}, &r1, nil)
+	time.Sleep(20 * time.Millisecond)
+	err = c1.SyncCall(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &r3)
+	_assert(errors.Is(err, zrpc.ErrServerOverloaded), "expect overloaded, got %v", err)
+	err = c2.SyncCall(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &r3)
+	_assert(err == nil && r3 == 3, "call on another connection failed: %v", err)
+	<-running.Done
+	_assert(running.Error == nil && <-sleepErr == nil, "admitted call failed: %v", running.Error)
+}
+
+func TestServer_GnetOptionTooLarge(t *testing.T) {
+	conn, err := net.Dial("tcp", startGnet(newTestServer()))
+	_assert(err == nil, "dial server failed: %v", err)
+	defer func() { _ = conn.Close() }()
+
+	// an option that never ends is not buffered forever
+	_, err = conn.Write([]byte(strings.Repeat("[", 8<<10)))
+	_assert(err == nil, "write option failed: %v", err)
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	_assert(err == io.EOF, "expect the connection to be closed, got %v", err)
+}
+
+func TestServer_GnetLargeMessage(t *testing.T) {
+	c, err := client.Dial("tcp", startGnet(newTestServer()), &codec.Option{CodecType: codec.ProtoType})
+	_assert(err == nil, "dial server failed: %v", err)
+	defer func() { _ = c.Close() }()
+
+	// a message arriving in many reads is buffered in linear time
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	reply := new(wrapperspb.StringValue)
+	err = c.SyncCall(ctx, "Echo.Upper", wrapperspb.String(strings.Repeat("z", 8<<20)), reply)
+	_assert(err == nil && len(reply.GetValue()) == 8<<20, "call with a large message failed: %v", err)
+}
+
+func TestServer_GnetBodyTooLarge(t *testing.T) {
+	s := newTestServer()
+	conn, err := net.Dial("tcp", startGnet(s))
+	_assert(err == nil, "dial server failed: %v", err)
+	defer func() { _ = conn.Close() }()
+	defer func() { _ = s.Close() }()
+
+	_ = json.NewEncoder(conn).Encode(codec.DefaultOpt)
+	header, _ := json.Marshal(&codec.Header{ServiceMethod: "Foo.Sum"})
+	prefix := make([]byte, codec.FrameHeaderSize)
+	fh := codec.FrameHeader{Version: codec.FrameVersion, Seq: 1, HeaderLen: uint32(len(header)), BodyLen: codec.MaxBodySize + 1}
+	fh.Marshal(prefix)
+	_, err = conn.Write(append(prefix, header...))
+	_assert(err == nil, "write frame failed: %v", err)
+	chunk := make([]byte, 1<<20)
+	for left := int(fh.BodyLen); left > 0; left -= len(chunk) {
+		if left < len(chunk) {
+			chunk = chunk[:left]
+		}
+		_, err = conn.Write(chunk)
+		_assert(err == nil, "write body failed: %v", err)
+	}
+
+	// only the oversized request fails, the connection keeps serving
+	cc, _ := codec.NewCodec(conn, codec.DefaultOpt)
+	err = cc.Write(&codec.Header{ServiceMethod: "Foo.Sum", Seq: 2}, &Args{Num1: 1, Num2: 2})
+	_assert(err == nil, "write request failed: %v", err)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var h codec.Header
+	err = cc.ReadHeader(&h)
+	_assert(err == nil && h.Seq == 1 && zrpc.Code(h.Code) == zrpc.CodeInvalidArgument && strings.Contains(h.Error, "too large"),
+		"expect body too large for seq 1, got %+v: %v", h, err)
+	_ = cc.ReadBody(nil)
+	var reply int
+	h = codec.Header{}
+	err = cc.ReadHeader(&h)
+	_assert(err == nil && h.Seq == 2 && h.Error == "", "expect reply for seq 2, got %+v: %v", h, err)
+	err = cc.ReadBody(&reply)
+	_assert(err == nil && reply == 3, "read reply failed: %v, reply %d", err, reply)
+}
+
+func TestServer_Auth(t *testing.T) {
+	key := []byte("billing-secret")
+	hmacAuth := &auth.HMAC{Keys: map[string][]byte{"billing": key}}
+	s := NewServer(WithAuth(
+		auth.AuthenticatorFunc(func(ctx context.Context, credential string) (string, error) {
+			if strings.HasPrefix(credential, auth.HMACPrefix) {
+				return hmacAuth.Authenticate(ctx, credential)
+			}
+			return auth.Tokens{"t-admin": "admin", "t-guest": "guest"}.Authenticate(ctx, credential)
+		}),
+		auth.NewPolicy().Allow("admin", "*").Allow("billing", "Foo.Sum").Allow("*", "Foo.Identity"),
+	))
+	_ = s.RegisterService(new(Foo))
+	addr := startAccept(s)
+	call := func(ctx context.Context, opt *codec.Option, serviceMethod string) (string, error) {
+		c, err := client.Dial("tcp", addr, opt)
+		_assert(err == nil, "dial server failed: %v", err)
+		defer func() { _ = c.Close() }()
+		var identity string
+		var sum int
+		if serviceMethod == "Foo.Sum" {
+			err = c.SyncCall(ctx, serviceMethod, &Args{Num1: 1, Num2: 2}, &sum)
+			return "", err
+		}
+		err = c.SyncCall(ctx, serviceMethod, &Args{}, &identity)
+		return identity, err
+	}
+	bg := context.Background()
+
+	// credential sent during the handshake
+	identity, err := call(bg, &codec.Option{Credential: auth.BearerToken("t-admin")}, "Foo.Identity")
+	_assert(err == nil && identity == "admin", "unexpected identity %q: %v", identity, err)
+	_, err = call(bg, &codec.Option{Credential: auth.BearerToken("t-guest")}, "Foo.Sum")
+	_assert(err != nil && errors.Is(err, zrpc.ErrPermissionDenied), "expect permission denied, got %v", err)
+	_, err = call(bg, nil, "Foo.Identity")
+	_assert(err != nil && errors.Is(err, zrpc.ErrUnauthenticated), "expect unauthenticated, got %v", err)
+
+	// per call credential overrides the handshake one
+	c, err := client.Dial("tcp", addr, &codec.Option{Credential: auth.BearerToken("t-guest")})
+	_assert(err == nil, "dial server failed: %v", err)
+	defer func() { _ = c.Close() }()
+	c.WithInterceptors(client.CredentialInterceptor(func(serviceMethod string) string {
+		return auth.SignHMAC("billing", key, serviceMethod, time.Now())
+	}))
+	var sum int
+	err = c.SyncCall(bg, "Foo.Sum", &Args{Num1: 1, Num2: 2}, &sum)
+	_assert(err == nil && sum == 3, "hmac call failed: %v", err)
+	err = c.SyncCall(bg, "Foo.Sum", &Args{Num1: 1, Num2: 2}, &sum)
+	_assert(err == nil && sum == 3, "a fresh credential per call must be accepted: %v", err)
+
+	// the signature is bound to the method and can't be replayed
+	ctx := auth.WithCredential(bg, auth.SignHMAC("billing", key, "Foo.Sum", time.Now()))
+	_, err = call(ctx, nil, "Foo.Identity")
+	_assert(errors.Is(err, zrpc.ErrUnauthenticated), "expect unauthenticated for another method, got %v", err)
+	_, err = call(ctx, nil, "Foo.Sum")
+	_assert(err == nil, "hmac call failed: %v", err)
+	_, err = call(ctx, nil, "Foo.Sum")
+	_assert(errors.Is(err, zrpc.ErrUnauthenticated), "expect a replay to be rejected, got %v", err)
+	ctx = auth.WithCredential(bg, auth.SignHMAC("billing", []byte("wrong"), "Foo.Sum", time.Now()))
+	_, err = call(ctx, nil, "Foo.Sum")
+	_assert(err != nil && errors.Is(err, zrpc.ErrUnauthenticated), "expect unauthenticated, got %v", err)
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	for _, start := range []func(*Server) string{startAccept, startGnet} {
+		s := newTestServer()
+		c, err := client.Dial("tcp", start(s))
+		_assert(err == nil, "dial server failed: %v", err)
+
+		// the in-flight call is still answered
+		var reply int
+		call := c.AsyncCall("Foo.Sleep", &Args{Num1: 200}, &reply, nil)
+		time.Sleep(50 * time.Millisecond)
+		done := make(chan error, 1)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			done <- s.Shutdown(ctx)
+		}()
+
+		for i := 0; i < 50 && c.IsAvailable(); i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		_assert(!c.IsAvailable(), "client did not receive go away")
+		err = c.SyncCall(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+		_assert(err == zrpc.ErrShutDown, "expect shut down after go away, got %v", err)
+
+		call = <-call.Done
+		_assert(call.Error == nil, "in-flight call failed: %v", call.Error)
+		_assert(<-sleepErr == nil, "in-flight handler was cancelled")
+		_assert(<-done == nil, "shutdown failed")
+		_ = c.Close()
+	}
+}
+
+func TestServer_Close(t *testing.T) {
+	s := newTestServer()
+	c, err := client.Dial("tcp", startAccept(s))
+	_assert(err == nil, "dial server failed: %v", err)
+	defer func() { _ = c.Close() }()
+
+	var reply int
+	call := c.AsyncCall("Foo.Sleep", &Args{Num1: 10000}, &reply, nil)
+	time.Sleep(50 * time.Millisecond)
+	_assert(s.Close() == nil, "close server failed")
+	select {
+	case call = <-call.Done:
+		_assert(call.Error != nil, "expect in-flight call to fail")
+	case <-time.After(time.Second):
+		_assert(false, "in-flight call was not terminated")
+	}
+	_assert(<-sleepErr == context.Canceled, "in-flight handler was not cancelled")
+}
+
+func TestServer_HTTP(t *testing.T) {
+	s := newTestServer()
+	s.Engine().GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "listen failed: %v", err)
+	defer func() { _ = l.Close() }()
+	go func() { _ = http.Serve(l, s) }()
+	addr := l.Addr().String()
+
+	c, err := client.DialHTTP("tcp", addr)
+	_assert(err == nil, "dial http failed: %v", err)
+	defer func() { _ = c.Close() }()
+	var reply int
+	err = c.SyncCall(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "call Foo.Sum over http failed: %v", err)
+
+	// plain http endpoints share the port
+	resp, err := http.Get("http://" + addr + "/ping")
+	_assert(err == nil && resp.StatusCode == http.StatusOK, "get /ping failed: %v", err)
+	_ = resp.Body.Close()
+
+	resp, err = http.Get("http://" + addr + DefaultDebugPath)
+	_assert(err == nil && resp.StatusCode == http.StatusOK, "get debug page failed: %v", err)
+	page, _ := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	_assert(strings.Contains(string(page), "Service Foo"), "debug page misses Foo: %s", page)
+
+	resp, err = http.Get("http://" + addr + DefaultDebugPath + "/json")
+	_assert(err == nil && resp.StatusCode == http.StatusOK, "get debug json failed: %v", err)
+	var services []debugService
+	err = json.NewDecoder(resp.Body).Decode(&services)
+	_ = resp.Body.Close()
+	_assert(err == nil && len(services) == 2 && services[1].Name == "Foo", "unexpected services %+v: %v", services, err)
+	for _, m := range services[1].Methods {
+		if m.Name == "Sum" {
+			_assert(m.Calls == 1 && m.ArgType == "server.Args" && m.ReplyType == "*int", "unexpected method %+v", m)
+		}
+	}
+}
+
+func TestServer_Heartbeat(t *testing.T) {
+	ts := httptest.NewServer(registry.New(time.Minute))
+	defer ts.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "listen failed: %v", err)
+	s := NewServer(WithHeartbeat(ts.URL, "tcp@"+l.Addr().String(), 20*time.Millisecond))
+	_ = s.RegisterService(new(Foo))
+	go s.Accept(l)
+	defer func() { _ = s.Close() }()
+
+	d := client.NewRegistryDiscovery(ts.URL, "Foo", 10*time.Millisecond)
+	var servers []client.Server
+	for i := 0; i < 50 && len(servers) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		servers, _ = d.GetAll()
+	}
+	_assert(len(servers) == 1 && servers[0].Addr == "tcp@"+l.Addr().String(), "server not registered: %v", servers)
+
+	c, err := client.DialDiscovery(d, client.RandomSelect)
+	_assert(err == nil, "dial discovery failed: %v", err)
+	defer func() { _ = c.Close() }()
+	var reply int
+	err = c.SyncCall(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "call Foo.Sum failed: %v", err)
+
+	empty, _ := client.NewRegistryDiscovery(ts.URL, "Missing", 0).GetAll()
+	_assert(len(empty) == 0, "unexpected servers for a missing service: %v", empty)
+
+	// a hung registry doesn't keep the server from accepting connections
+	hung := make(chan struct{})
+	hts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-hung }))
+	defer hts.Close()
+	defer close(hung)
+	s2 := NewServer(WithHeartbeat(hts.URL, "tcp@127.0.0.1:0", time.Minute))
+	_ = s2.RegisterService(new(Foo))
+	defer func() { _ = s2.Close() }()
+	c2, err := client.Dial("tcp", startAccept(s2), &codec.Option{ConnectTimeout: time.Second})
+	_assert(err == nil, "dial server failed: %v", err)
+	defer func() { _ = c2.Close() }()
+	err = c2.SyncCall(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "call Foo.Sum failed: %v", err)
+}
+
+func TestServer_CircuitBreaker(t *testing.T) {
+	c, err := client.Dial("tcp", startAccept(newTestServer()), &codec.Option{HandleTimeout: 20 * time.Millisecond})
+	_assert(err == nil, "dial server failed: %v", err)
+	defer func() { _ = c.Close() }()
+	c.WithInterceptors(client.BreakerInterceptor(client.NewBreakerGroup(client.BreakerConfig{
+		ConsecutiveFailures: 2,
+		Cooldown:            time.Minute,
+		PerMethod:           true,
+	})))
+
+	var reply int
+	for i := 0; i < 2; i++ {
+		err = c.SyncCall(context.Background(), "Foo.Sleep", &Args{Num1: 10000}, &reply)
+		_assert(err != nil && err.Error() == zrpc.ServerHandleRequestTimeOut.Error(), "expect handle timeout, got %v", err)
+		<-sleepErr
+	}
+	start := time.Now()
+	err = c.SyncCall(context.Background(), "Foo.Sleep", &Args{Num1: 10000}, &reply)
+	_assert(err == zrpc.ErrCircuitOpen && time.Since(start) < 10*time.Millisecond, "expect fast circuit open, got %v", err)
+
+	// other methods have their own circuit
+	err = c.SyncCall(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "call Foo.Sum failed: %v", err)
+}
+
+func TestServer_Accept(t *testing.T) {
+	testServe(t, startAccept(newTestServer()))
+}
+
+func TestServer_ServeGnet(t *testing.T) {
+	testServe(t, startGnet(newTestServer()))
+}
+
+func benchmarkSum(b *testing.B, addr string) {
+	c, err := client.Dial("tcp", addr)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() { _ = c.Close() }()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var reply int
+		for pb.Next() {
+			if err := c.SyncCall(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkServer_Accept(b *testing.B) {
+	benchmarkSum(b, startAccept(newTestServer()))
+}
+
+func BenchmarkServer_ServeGnet(b *testing.B) {
+	benchmarkSum(b, startGnet(newTestServer()))
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"net"
+	"time"
+	"zrpc/logger"
+
+	"github.com/panjf2000/gnet"
+)
+
+// shutdownPollInterval Shutdown检查进行中请求的间隔
+const shutdownPollInterval = 10 * time.Millisecond
+
+// Shutdown 优雅关闭：停止接受新连接，通知已连接的客户端不再发送新的调用，
+// 等待进行中的请求处理完后关闭所有连接。ctx到期时立即关闭并返回ctx.Err()
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stop()
+	s.mu.Lock()
+	s.inShutdown = true
+	err := s.closeListenersLocked()
+	conns := make([]*serverConn, 0, len(s.conns))
+	for sc := range s.conns {
+		conns = append(conns, sc)
+	}
+	s.mu.Unlock()
+
+	for _, sc := range conns {
+		sc.goAway()
+	}
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for !s.idle() {
+		select {
+		case <-ctx.Done():
+			_ = s.Close()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	if cerr := s.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Close 立即关闭：关闭监听和所有连接，进行中请求的ctx被取消，不再响应
+func (s *Server) Close() error {
+	s.stop()
+	s.mu.Lock()
+	s.inShutdown = true
+	err := s.closeListenersLocked()
+	for sc := range s.conns {
+		_ = sc.cc.Close()
+	}
+	addrs := s.gnetAddrs
+	s.gnetAddrs = nil
+	s.mu.Unlock()
+
+	for addr := range addrs {
+		if gerr := gnet.Stop(context.Background(), "tcp://"+addr); gerr != nil {
+			logger.Error("stop gnet server failed,err:%v", gerr)
+		}
+	}
+	return err
+}
+
+// stop 停止心跳等后台任务
+func (s *Server) stop() {
+	s.doneOnce.Do(func() { close(s.done) })
+}
+
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inShutdown
+}
+
+func (s *Server) idle() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sc := range s.conns {
+		if !sc.idle() {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) closeListenersLocked() error {
+	var err error
+	for l := range s.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		delete(s.listeners, l)
+	}
+	return err
+}
+
+// trackListener 关闭中的服务器不再添加
+func (s *Server) trackListener(l net.Listener, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !add {
+		delete(s.listeners, l)
+		return true
+	}
+	if s.inShutdown {
+		return false
+	}
+	s.listeners[l] = struct{}{}
+	return true
+}
+
+// trackConn 握手完成后登记连接，关闭中的服务器不再添加
+func (s *Server) trackConn(sc *serverConn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !add {
+		delete(s.conns, sc)
+		return true
+	}
+	if s.inShutdown {
+		return false
+	}
+	s.conns[sc] = struct{}{}
+	return true
+}
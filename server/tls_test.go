@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+	"zrpc"
+	"zrpc/auth"
+	"zrpc/client"
+	"zrpc/codec"
+	"zrpc/peer"
+)
+
+// Subject reports the common name of the caller's verified certificate
+func (f Foo) Subject(ctx context.Context, args Args, reply *string) error {
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(peer.TLSInfo); ok {
+			if subject, ok := info.Subject(); ok {
+				*reply = subject.CommonName
+			}
+		}
+	}
+	return nil
+}
+
+// testCert issues a certificate signed by parent, or a self signed CA when parent is nil
+func testCert(cn string, parent *tls.Certificate, isCA bool) tls.Certificate {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := tmpl, interface{}(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		panic(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestServer_ServeTLS(t *testing.T) {
+	ca := testCert("zrpc test ca", nil, true)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	serverCert := testCert("foo-server", &ca, false)
+	clientCert := testCert("billing", &ca, false)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "listen failed: %v", err)
+	go newTestServer().ServeTLS(l, &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	})
+	addr := l.Addr().String()
+
+	// mutual TLS: the method sees the client's certificate subject
+	c, err := client.DialTLS("tcp", addr, &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{clientCert}})
+	_assert(err == nil, "dial tls failed: %v", err)
+	var subject string
+	err = c.SyncCall(context.Background(), "Foo.Subject", &Args{}, &subject)
+	_assert(err == nil && subject == "billing", "unexpected subject %q: %v", subject, err)
+	_ = c.Close()
+
+	// server only TLS: calls work, there is no verified subject
+	c, err = client.DialTLS("tcp", addr, &tls.Config{RootCAs: pool})
+	_assert(err == nil, "dial tls failed: %v", err)
+	subject = ""
+	err = c.SyncCall(context.Background(), "Foo.Subject", &Args{}, &subject)
+	_assert(err == nil && subject == "", "unexpected subject %q: %v", subject, err)
+	_ = c.Close()
+
+	// the server certificate must be trusted
+	_, err = client.DialTLS("tcp", addr, &tls.Config{})
+	_assert(err != nil, "expect untrusted server certificate to be rejected")
+
+	// pooled and managed clients dial tls@ with Option.TLSConfig
+	opt := &codec.Option{TLSConfig: &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{clientCert}}}
+	cc := client.NewClientCache(opt)
+	err = cc.Broadcast(context.Background(), []string{"tls@" + addr}, "Foo.Subject", &Args{}, &subject)
+	_assert(err == nil && subject == "billing", "unexpected subject %q: %v", subject, err)
+	_ = cc.Close()
+	mc, err := client.NewManagedClient("tls@"+addr, client.DefaultManagedConfig, opt)
+	_assert(err == nil, "new managed client failed: %v", err)
+	subject = ""
+	err = mc.SyncCall(context.Background(), "Foo.Subject", &Args{}, &subject)
+	_assert(err == nil && subject == "billing", "unexpected subject %q: %v", subject, err)
+	_ = mc.Close()
+
+	// the client certificate as the identity for WithAuth, no credential is sent
+	s := NewServer(WithAuth(auth.TLSSubject{}, auth.NewPolicy().Allow("billing", "Foo.*")))
+	_ = s.RegisterService(new(Foo))
+	l, err = net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "listen failed: %v", err)
+	go s.ServeTLS(l, &tls.Config{Certificates: []tls.Certificate{serverCert}, ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven})
+	defer func() { _ = s.Close() }()
+	c, err = client.DialTLS("tcp", l.Addr().String(), &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{clientCert}})
+	_assert(err == nil, "dial tls failed: %v", err)
+	var identity string
+	err = c.SyncCall(context.Background(), "Foo.Identity", &Args{}, &identity)
+	_assert(err == nil && identity == "billing", "unexpected identity %q: %v", identity, err)
+	_ = c.Close()
+	c, err = client.DialTLS("tcp", l.Addr().String(), &tls.Config{RootCAs: pool})
+	_assert(err == nil, "dial tls failed: %v", err)
+	err = c.SyncCall(context.Background(), "Foo.Identity", &Args{}, &identity)
+	_assert(errors.Is(err, zrpc.ErrUnauthenticated), "expect unauthenticated without a client certificate, got %v", err)
+	_ = c.Close()
+}
+
+func TestServer_TLSHandshakeTimeout(t *testing.T) {
+	ca := testCert("zrpc test ca", nil, true)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "listen failed: %v", err)
+	s := NewServer(WithTLSHandshakeTimeout(100 * time.Millisecond))
+	go s.ServeTLS(l, &tls.Config{Certificates: []tls.Certificate{testCert("foo-server", &ca, false)}})
+	defer func() { _ = s.Close() }()
+
+	// the peer never sends a ClientHello
+	conn, err := net.Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial failed: %v", err)
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	_assert(err == io.EOF, "expect the server to close the connection, got %v", err)
+}
@@ -1,16 +1,26 @@
 package service
 
 import (
+	"context"
+	"fmt"
 	"go/ast"
 	"reflect"
+	"runtime/debug"
 	"sync/atomic"
+	"zrpc"
 	"zrpc/logger"
 )
 
+var (
+	typeOfError   = reflect.TypeOf((*error)(nil)).Elem()
+	typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
 type MethodType struct {
 	method    reflect.Method // 方法
 	ArgType   reflect.Type   // 入参类型
 	ReplyType reflect.Type   // 返回值类型
+	HasCtx    bool           // 第一个参数是否为context.Context
 	numCalls  uint64         // 调用次数
 }
 
@@ -74,14 +84,20 @@ func (s *Service) registerMethods() {
 		// 获取method
 		method := s.Typ.Method(i)
 		methodType := method.Type
-		if methodType.NumIn() != 3 || methodType.NumOut() != 1 {
+		// func(recv, args, *reply) error 或 func(recv, ctx, args, *reply) error
+		hasCtx := methodType.NumIn() == 4 && methodType.In(1) == typeOfContext
+		if (methodType.NumIn() != 3 && !hasCtx) || methodType.NumOut() != 1 {
 			continue
 		}
-		if methodType.Out(0) != reflect.TypeOf((*error)(nil)).Elem() {
+		if methodType.Out(0) != typeOfError {
 			continue
 		}
 		// 分别获取方法的入参和返回值
-		argType, replyType := methodType.In(1), methodType.In(2)
+		argIndex := 1
+		if hasCtx {
+			argIndex = 2
+		}
+		argType, replyType := methodType.In(argIndex), methodType.In(argIndex+1)
 		if !isExportedOrBuiltinType(argType) || !isExportedOrBuiltinType(replyType) {
 			continue
 		}
@@ -89,6 +105,7 @@ func (s *Service) registerMethods() {
 			method:    method,
 			ArgType:   argType,
 			ReplyType: replyType,
+			HasCtx:    hasCtx,
 		}
 
 		logger.Info("rpc server register methods, service Name:" + s.Name + " ,Method Name:" + method.Name)
@@ -99,17 +116,47 @@ func isExportedOrBuiltinType(t reflect.Type) bool {
 	return ast.IsExported(t.Name()) || t.PkgPath() == ""
 }
 
-// Call 用反射完成函数的调用
-func (s *Service) Call(m *MethodType, arg, reply reflect.Value) error {
+// Call 用反射完成函数的调用，方法不接收context时忽略ctx
+// 方法panic时recover，返回*PanicError，同时打印堆栈
+func (s *Service) Call(ctx context.Context, m *MethodType, arg, reply reflect.Value) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			pe := &PanicError{ServiceMethod: s.Name + "." + m.method.Name, Value: v, Stack: debug.Stack()}
+			logger.Error("rpc server %v\n%s", pe, pe.Stack)
+			err = pe
+		}
+	}()
 	// 将方法的使用次数自增
 	atomic.AddUint64(&m.numCalls, 1)
 	// 取出方法函数
 	f := m.method.Func
-	// 调用函数，入参:service,arg,reply
-	returnValues := f.Call([]reflect.Value{s.Self, arg, reply})
+	// 调用函数，入参:service,(ctx),arg,reply
+	in := []reflect.Value{s.Self, arg, reply}
+	if m.HasCtx {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		in = []reflect.Value{s.Self, reflect.ValueOf(ctx), arg, reply}
+	}
+	returnValues := f.Call(in)
 	// 返回值错误判断
 	if errInter := returnValues[0].Interface(); errInter != nil {
 		return errInter.(error)
 	}
 	return nil
 }
+
+// PanicError 方法panic后返回给调用方的错误，客户端收到的是CodeInternal的zrpc.Status
+type PanicError struct {
+	ServiceMethod string
+	Value         interface{} // recover()的返回值
+	Stack         []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic in %s: %v", e.ServiceMethod, e.Value)
+}
+
+func (e *PanicError) Unwrap() error {
+	return zrpc.NewStatus(zrpc.CodeInternal, e.Error())
+}
@@ -1,9 +1,12 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
+	"zrpc"
 )
 
 type Foo int
@@ -15,6 +18,16 @@ func (f Foo) Sum(args Args, reply *int) error {
 	return nil
 }
 
+func (f Foo) SumCtx(ctx context.Context, args Args, reply *int) error {
+	if v, ok := ctx.Value(ctxKey{}).(int); ok {
+		*reply = v
+	}
+	*reply += args.Num1 + args.Num2
+	return nil
+}
+
+type ctxKey struct{}
+
 // it's not a exported Method
 func (f Foo) sum(args Args, reply *int) error {
 	*reply = args.Num1 + args.Num2
@@ -30,9 +43,11 @@ func _assert(condition bool, msg string, v ...interface{}) {
 func TestNewService(t *testing.T) {
 	var foo Foo
 	s := NewService(&foo)
-	_assert(len(s.Method) == 1, "wrong service Method, expect 1, but got %d", len(s.Method))
+	_assert(len(s.Method) == 2, "wrong service Method, expect 2, but got %d", len(s.Method))
 	mType := s.Method["Sum"]
-	_assert(mType != nil, "wrong Method, Sum shouldn't nil")
+	_assert(mType != nil && !mType.HasCtx, "wrong Method, Sum shouldn't nil")
+	mType = s.Method["SumCtx"]
+	_assert(mType != nil && mType.HasCtx, "wrong Method, SumCtx should take context")
 }
 
 func TestMethodType_Call(t *testing.T) {
@@ -43,6 +58,37 @@ func TestMethodType_Call(t *testing.T) {
 	argv := mType.NewArgv()
 	replyv := mType.NewReplyv()
 	argv.Set(reflect.ValueOf(Args{Num1: 1, Num2: 3}))
-	err := s.Call(mType, argv, replyv)
+	err := s.Call(context.Background(), mType, argv, replyv)
 	_assert(err == nil && *replyv.Interface().(*int) == 4 && mType.NumCalls() == 1, "failed to call Foo.Sum")
 }
+
+func TestMethodType_CallWithContext(t *testing.T) {
+	var foo Foo
+	s := NewService(&foo)
+	mType := s.Method["SumCtx"]
+
+	argv := mType.NewArgv()
+	replyv := mType.NewReplyv()
+	argv.Set(reflect.ValueOf(Args{Num1: 1, Num2: 3}))
+	ctx := context.WithValue(context.Background(), ctxKey{}, 10)
+	err := s.Call(ctx, mType, argv, replyv)
+	_assert(err == nil && *replyv.Interface().(*int) == 14, "failed to call Foo.SumCtx")
+}
+
+type Bad int
+
+func (b Bad) Boom(args Args, reply *int) error {
+	var m map[string]int
+	m["boom"] = args.Num1
+	return nil
+}
+
+func TestService_CallPanic(t *testing.T) {
+	s := NewService(new(Bad))
+	mType := s.Method["Boom"]
+	err := s.Call(context.Background(), mType, mType.NewArgv(), mType.NewReplyv())
+	var pe *PanicError
+	_assert(errors.As(err, &pe) && pe.ServiceMethod == "Bad.Boom" && len(pe.Stack) > 0, "expect PanicError, got %v", err)
+	_assert(zrpc.CodeOf(err) == zrpc.CodeInternal, "expect CodeInternal, got %v", zrpc.CodeOf(err))
+	_assert(mType.NumCalls() == 1, "panicking call should still be counted")
+}
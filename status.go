@@ -0,0 +1,127 @@
+package zrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Code the kind of a failed call, sent along with the error message so the
+// client can tell a missing method from a handler error or a timeout
+type Code uint32
+
+const (
+	CodeOK Code = iota
+	CodeCanceled
+	CodeUnknown
+	CodeInvalidArgument
+	CodeDeadlineExceeded
+	CodeNotFound
+	CodeAlreadyExists
+	CodePermissionDenied
+	CodeResourceExhausted
+	CodeFailedPrecondition
+	CodeUnimplemented
+	CodeInternal
+	CodeUnavailable
+	CodeUnauthenticated
+)
+
+var codeNames = [...]string{
+	"ok", "canceled", "unknown", "invalid argument", "deadline exceeded", "not found", "already exists",
+	"permission denied", "resource exhausted", "failed precondition", "unimplemented", "internal",
+	"unavailable", "unauthenticated",
+}
+
+func (c Code) String() string {
+	if int(c) < len(codeNames) {
+		return codeNames[c]
+	}
+	return fmt.Sprintf("code(%d)", uint32(c))
+}
+
+// Status an error with a Code, errors returned by service methods reach the
+// client as *Status; Error() is just the message so existing checks on the
+// text keep working
+type Status struct {
+	Code    Code
+	Message string
+	Details []string
+}
+
+func NewStatus(code Code, message string, details ...string) *Status {
+	return &Status{Code: code, Message: message, Details: details}
+}
+
+// Errorf a *Status service methods can return to choose the code
+func Errorf(code Code, format string, a ...interface{}) error {
+	return NewStatus(code, fmt.Sprintf(format, a...))
+}
+
+func (s *Status) Error() string {
+	return s.Message
+}
+
+// Is matches a *Status with the same Code, and the sentinel errors of this
+// package whose message the status carries, so that e.g.
+// errors.Is(err, zrpc.NotFoundMethod) holds for an error sent by the server
+func (s *Status) Is(target error) bool {
+	if t, ok := target.(*Status); ok {
+		return s.Code == t.Code && (t.Message == "" || s.Message == t.Message)
+	}
+	for _, sentinel := range sentinels {
+		if sentinel.err != target {
+			continue
+		}
+		msg := target.Error()
+		return s.Code == sentinel.code && (s.Message == msg || strings.HasPrefix(s.Message, msg+":"))
+	}
+	return false
+}
+
+var sentinels = []struct {
+	err  error
+	code Code
+}{
+	{ErrShutDown, CodeUnavailable},
+	{ServiceAlreadyExist, CodeAlreadyExists},
+	{NotMatchRpcArgs, CodeInvalidArgument},
+	{NotFoundService, CodeNotFound},
+	{NotFoundMethod, CodeNotFound},
+	{RpcClientConnectTimeOut, CodeDeadlineExceeded},
+	{RpcClientCallServiceTimeOut, CodeDeadlineExceeded},
+	{ServerHandleRequestTimeOut, CodeDeadlineExceeded},
+	{ErrCircuitOpen, CodeUnavailable},
+	{ErrUnauthenticated, CodeUnauthenticated},
+	{ErrPermissionDenied, CodePermissionDenied},
+	{ErrServerOverloaded, CodeResourceExhausted},
+	{context.DeadlineExceeded, CodeDeadlineExceeded},
+	{context.Canceled, CodeCanceled},
+}
+
+// StatusFromError a *Status found in err's chain, otherwise a Status with the
+// code of the sentinel err wraps (CodeUnknown if none) and err's message
+func StatusFromError(err error) *Status {
+	if err == nil {
+		return nil
+	}
+	var s *Status
+	if errors.As(err, &s) {
+		return s
+	}
+	for _, sentinel := range sentinels {
+		if errors.Is(err, sentinel.err) {
+			return NewStatus(sentinel.code, err.Error())
+		}
+	}
+	return NewStatus(CodeUnknown, err.Error())
+}
+
+// CodeOf CodeOK for nil
+func CodeOf(err error) Code {
+	if err == nil {
+		return CodeOK
+	}
+	return StatusFromError(err).Code
+}
@@ -0,0 +1,82 @@
+package xclient
+
+import (
+	"context"
+	"zrpc/client"
+	"zrpc/codec"
+)
+
+// XClient 持有到多个服务端的连接，每次调用从Discovery取出服务端列表，按Selector选出一个
+type XClient struct {
+	d        client.Discovery
+	selector client.Selector
+	cache    *client.ClientCache
+	retry    *client.RetryPolicy
+}
+
+func NewXClient(d client.Discovery, mode client.SelectMode, opt *codec.Option) *XClient {
+	return NewXClientWithSelector(d, client.NewSelector(mode), opt)
+}
+
+// NewXClientWithSelector 使用自定义的Selector
+func NewXClientWithSelector(d client.Discovery, selector client.Selector, opt *codec.Option) *XClient {
+	return &XClient{
+		d:        d,
+		selector: selector,
+		cache:    client.NewClientCache(opt),
+	}
+}
+
+// WithInterceptors 每个服务端的客户端都使用这些拦截器，如client.BreakerInterceptor；
+// 需要在发起调用前设置
+func (xc *XClient) WithInterceptors(interceptors ...client.Interceptor) *XClient {
+	xc.cache.WithInterceptors(interceptors...)
+	return xc
+}
+
+// WithRetry 失败的调用按p重试，每次重试重新选择服务端；需要在发起调用前设置
+func (xc *XClient) WithRetry(p *client.RetryPolicy) *XClient {
+	xc.retry = p
+	return xc
+}
+
+func (xc *XClient) Close() error {
+	return xc.cache.Close()
+}
+
+// Call 选出一个服务端发起同步调用，一致性哈希的key通过client.WithHashKey设置，
+// 单次调用的重试策略通过client.WithRetryPolicy设置
+func (xc *XClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	return client.RetryPolicyFromContext(ctx, xc.retry).Do(ctx, serviceMethod, func(ctx context.Context) error {
+		return xc.call(ctx, serviceMethod, args, reply)
+	})
+}
+
+func (xc *XClient) call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	servers, err := xc.d.GetAll()
+	if err != nil {
+		return err
+	}
+	server, err := xc.selector.Select(ctx, servers, xc.cache.Pending)
+	if err != nil {
+		return err
+	}
+	c, err := xc.cache.Dial(server.Addr)
+	if err != nil {
+		return err
+	}
+	return c.SyncCall(ctx, serviceMethod, args, reply)
+}
+
+// Broadcast 调用Discovery中的所有服务端，见client.ClientCache.Broadcast
+func (xc *XClient) Broadcast(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	servers, err := xc.d.GetAll()
+	if err != nil {
+		return err
+	}
+	addrs := make([]string, 0, len(servers))
+	for _, server := range servers {
+		addrs = append(addrs, server.Addr)
+	}
+	return xc.cache.Broadcast(ctx, addrs, serviceMethod, args, reply)
+}
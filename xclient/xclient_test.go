@@ -0,0 +1,131 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+	"zrpc/client"
+	"zrpc/logger"
+	"zrpc/server"
+)
+
+type Foo int
+
+type Args struct{ Num1, Num2 int }
+
+func (f Foo) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+// Who reports which test server answered
+func (f Foo) Who(args Args, reply *int) error {
+	*reply = int(f)
+	return nil
+}
+
+// Fail fails on server Num1, the others wait until they are cancelled
+func (f Foo) Fail(ctx context.Context, args Args, reply *int) error {
+	if int(f) == args.Num1 {
+		return errors.New("fail")
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func init() {
+	logger.SetLevel(logger.LevelNone)
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed: "+msg, v...))
+	}
+}
+
+func startServer(id int) string {
+	s := server.NewServer()
+	foo := Foo(id)
+	_ = s.RegisterService(&foo)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	go s.Accept(l)
+	return "tcp@" + l.Addr().String()
+}
+
+func TestXClient_Call(t *testing.T) {
+	d := client.NewStaticDiscoveryAddrs(startServer(1), startServer(2))
+	for _, mode := range []client.SelectMode{client.RandomSelect, client.RoundRobinSelect, client.WeightedRoundRobinSelect, client.LeastPendingSelect, client.ConsistentHashSelect} {
+		xc := NewXClient(d, mode, nil)
+		for i := 0; i < 10; i++ {
+			var reply int
+			err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: i, Num2: 1}, &reply)
+			_assert(err == nil && reply == i+1, "mode %d: call failed: %v", mode, err)
+		}
+		_assert(xc.cache.Len() <= 2, "unexpected clients %d", xc.cache.Len())
+
+		// unavailable clients are evicted and dialed again
+		servers, _ := d.GetAll()
+		for _, server := range servers {
+			c, _ := xc.cache.Dial(server.Addr)
+			_ = c.Close()
+		}
+		var reply int
+		err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 1}, &reply)
+		_assert(err == nil && reply == 2, "mode %d: call after close failed: %v", mode, err)
+		_ = xc.Close()
+	}
+}
+
+func TestDialDiscovery(t *testing.T) {
+	c, err := client.DialDiscovery(client.NewStaticDiscoveryAddrs(startServer(1)), client.RandomSelect)
+	_assert(err == nil, "dial discovery failed: %v", err)
+	defer func() { _ = c.Close() }()
+	var reply int
+	err = c.SyncCall(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "call failed: %v", err)
+}
+
+func TestXClient_Broadcast(t *testing.T) {
+	xc := NewXClient(client.NewStaticDiscoveryAddrs(startServer(1), startServer(2)), client.RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	var who int
+	err := xc.Broadcast(context.Background(), "Foo.Who", &Args{}, &who)
+	_assert(err == nil && (who == 1 || who == 2), "broadcast Foo.Who failed: %v, reply %d", err, who)
+
+	// the first error cancels the calls still running
+	start := time.Now()
+	err = xc.Broadcast(context.Background(), "Foo.Fail", &Args{Num1: 2}, nil)
+	_assert(err != nil && err.Error() == "fail", "expect fail, got %v", err)
+	_assert(time.Since(start) < time.Second, "broadcast waited for the cancelled calls")
+
+	err = client.Broadcast(context.Background(), []string{startServer(3)}, "Foo.Who", &Args{}, &who)
+	_assert(err == nil && who == 3, "client.Broadcast failed: %v, reply %d", err, who)
+}
+
+func TestXClient_Retry(t *testing.T) {
+	// the first server refuses connections, retries move on to the next one
+	d := client.NewStaticDiscoveryAddrs("tcp@127.0.0.1:1", startServer(1))
+	xc := NewXClient(d, client.RoundRobinSelect, nil).WithRetry(&client.RetryPolicy{
+		MaxAttempts:       2,
+		InitialBackoff:    time.Millisecond,
+		IdempotentMethods: []string{"Foo.Sum"},
+	})
+	defer func() { _ = xc.Close() }()
+
+	for i := 0; i < 4; i++ {
+		var reply int
+		err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: i, Num2: 1}, &reply)
+		_assert(err == nil && reply == i+1, "call Foo.Sum failed: %v", err)
+	}
+	var who int
+	err := xc.Call(context.Background(), "Foo.Who", &Args{}, &who)
+	err2 := xc.Call(context.Background(), "Foo.Who", &Args{}, &who)
+	_assert(err != nil || err2 != nil, "non idempotent Foo.Who was retried")
+}